@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// asnPrefixesURL is the RIPEstat endpoint listing the prefixes an ASN announces.
+const asnPrefixesURL = "https://stat.ripe.net/data/announced-prefixes/data.json?resource="
+
+// reverseLookups is how many reverse DNS lookups run at once while expanding an ASN.
+const reverseLookups = 50
+
+// normalizeASN turns "12345", "as12345" or "AS12345" into "AS12345".
+func normalizeASN(asn string) (string, error) {
+	asn = strings.ToUpper(strings.TrimSpace(asn))
+	digits := strings.TrimPrefix(asn, "AS")
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", fmt.Errorf("invalid ASN %q", asn)
+	}
+	return "AS" + digits, nil
+}
+
+// asnPrefixes returns the CIDR blocks currently announced by asn according to RIPEstat.
+func asnPrefixes(ctx context.Context, client *http.Client, asn, userAgent string) ([]string, error) {
+	data, err := fetchBody(ctx, client, asnPrefixesURL+url.QueryEscape(asn), userAgent, 16<<20)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Data struct {
+			Prefixes []struct {
+				Prefix string `json:"prefix"`
+			} `json:"prefixes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	prefixes := make([]string, 0, len(result.Data.Prefixes))
+	for _, p := range result.Data.Prefixes {
+		prefixes = append(prefixes, p.Prefix)
+	}
+	return prefixes, nil
+}
+
+// prefixAddresses returns up to limit addresses of an IPv4 CIDR block, in order.
+// IPv6 blocks are far too large to walk and return an error.
+func prefixAddresses(cidr string, limit int) ([]net.IP, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("%s is an IPv6 prefix", cidr)
+	}
+	var ips []net.IP
+	for ip := ipNet.IP.To4(); ipNet.Contains(ip) && len(ips) < limit; ip = nextIP(ip) {
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+// nextIP returns the address following ip.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// reverseTargets resolves the PTR names of every address, returning the
+// hostnames found or the address itself when it has none. The results keep
+// the order of ips.
+func reverseTargets(resolver *net.Resolver, ips []net.IP) []string {
+	names := make([][]string, len(ips))
+	slots := make(chan struct{}, reverseLookups)
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, ip net.IP) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			ctx, cancel := context.WithTimeout(context.Background(), wildcardLookupTimeout)
+			defer cancel()
+			hosts, err := resolver.LookupAddr(ctx, ip.String())
+			if err != nil || len(hosts) == 0 {
+				names[i] = []string{ip.String()}
+				return
+			}
+			for _, host := range hosts {
+				names[i] = append(names[i], strings.TrimSuffix(host, "."))
+			}
+		}(i, ip)
+	}
+	wg.Wait()
+
+	var targets []string
+	for _, n := range names {
+		targets = append(targets, n...)
+	}
+	return targets
+}
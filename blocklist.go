@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// blocklist holds the out-of-scope patterns loaded with -blocklist.
+type blocklist struct {
+	// urls are blocked exactly, ignoring a trailing slash
+	urls map[string]struct{}
+	// prefixes block every URL whose path starts with them, on any host
+	prefixes []string
+}
+
+// loadBlocklist reads a blocklist file. Each line is either an absolute URL,
+// which is blocked exactly, or a path starting with /, which blocks every URL
+// under it. Blank lines and lines starting with # are ignored.
+func loadBlocklist(filename string) (*blocklist, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	b := &blocklist{urls: make(map[string]struct{})}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "/"):
+			b.prefixes = append(b.prefixes, line)
+		default:
+			b.urls[strings.TrimSuffix(line, "/")] = struct{}{}
+		}
+	}
+	return b, scanner.Err()
+}
+
+// blocks reports whether u matches the blocklist. A nil blocklist blocks nothing.
+func (b *blocklist) blocks(u string) bool {
+	if b == nil {
+		return false
+	}
+	if _, ok := b.urls[strings.TrimSuffix(u, "/")]; ok {
+		return true
+	}
+	if len(b.prefixes) == 0 {
+		return false
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range b.prefixes {
+		if strings.HasPrefix(parsed.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
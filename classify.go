@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// classExternal labels findings outside the target's scope, whatever the rules say.
+const classExternal = "external"
+
+// classOther labels findings that no rule matches.
+const classOther = "other"
+
+// classRule assigns class to URLs whose path has one of the extensions ("" for
+// no extension) or whose lowercased path or query contains one of the substrings.
+type classRule struct {
+	Class      string   `yaml:"class"`
+	Extensions []string `yaml:"extensions"`
+	Contains   []string `yaml:"contains"`
+}
+
+// defaultClassRules is the built-in ruleset for -classify. The first matching
+// rule wins, so api comes before page to catch /api/users and before asset to
+// catch .json.
+var defaultClassRules = []classRule{
+	{Class: "api", Extensions: []string{".json"}, Contains: []string{"/api/", "/v1/", "/v2/", "/v3/", "graphql", "/rest/"}},
+	{Class: "document", Extensions: []string{".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".odt", ".ods", ".rtf", ".csv", ".txt"}},
+	{Class: "asset", Extensions: []string{
+		".js", ".mjs", ".map", ".css",
+		".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico", ".webp",
+		".woff", ".woff2", ".ttf", ".eot", ".otf",
+		".mp4", ".webm", ".mp3", ".wasm",
+	}},
+	{Class: "page", Extensions: []string{"", ".html", ".htm", ".xhtml", ".php", ".asp", ".aspx", ".jsp", ".cfm", ".cgi", ".pl"}},
+}
+
+// classifier labels URLs with the first matching rule.
+type classifier []classRule
+
+// loadClassRules reads a YAML list of rules replacing the built-in ones.
+func loadClassRules(filename string) (classifier, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rules []classRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		for j, ext := range rules[i].Extensions {
+			if ext != "" {
+				rules[i].Extensions[j] = normalizeExtension(ext)
+			}
+		}
+	}
+	return classifier(rules), nil
+}
+
+// classify returns the class of u. External findings are always external.
+func (c classifier) classify(u string, external bool) string {
+	if external {
+		return classExternal
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return classOther
+	}
+	p := strings.ToLower(parsed.Path)
+	target := p + "?" + strings.ToLower(parsed.RawQuery)
+	ext := path.Ext(p)
+
+	for _, rule := range c {
+		for _, e := range rule.Extensions {
+			if e == ext {
+				return rule.Class
+			}
+		}
+		for _, s := range rule.Contains {
+			if strings.Contains(target, strings.ToLower(s)) {
+				return rule.Class
+			}
+		}
+	}
+	return classOther
+}
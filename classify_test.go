@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// classCorpus is a labelled set of example URLs for the built-in rules.
+var classCorpus = []struct {
+	url      string
+	external bool
+	want     string
+}{
+	{"https://example.com/", false, "page"},
+	{"https://example.com/about", false, "page"},
+	{"https://example.com/About.HTML", false, "page"},
+	{"https://example.com/login.php?next=/", false, "page"},
+	{"https://example.com/default.aspx", false, "page"},
+	{"https://example.com/static/app.js", false, "asset"},
+	{"https://example.com/static/app.js.map", false, "asset"},
+	{"https://example.com/css/site.css?v=3", false, "asset"},
+	{"https://example.com/img/logo.PNG", false, "asset"},
+	{"https://example.com/fonts/inter.woff2", false, "asset"},
+	{"https://example.com/api/users", false, "api"},
+	{"https://example.com/v1/orders/7", false, "api"},
+	{"https://example.com/graphql", false, "api"},
+	{"https://example.com/config.json", false, "api"},
+	{"https://example.com/rest/items.php", false, "api"},
+	{"https://example.com/search?endpoint=/api/x", false, "api"},
+	{"https://example.com/files/report.pdf", false, "document"},
+	{"https://example.com/export/users.csv", false, "document"},
+	{"https://example.com/docs/Plan.DOCX", false, "document"},
+	{"https://example.com/backup.tar.gz", false, "other"},
+	{"https://example.com/feed.xml", false, "other"},
+	{"https://cdn.other.net/app.js", true, "external"},
+	{"https://other.net/api/users", true, "external"},
+	{"%zz", false, "other"},
+}
+
+func TestClassifyCorpus(t *testing.T) {
+	classes := classifier(defaultClassRules)
+	for _, tt := range classCorpus {
+		if got := classes.classify(tt.url, tt.external); got != tt.want {
+			t.Errorf("classify(%q, %v) = %q, want %q", tt.url, tt.external, got, tt.want)
+		}
+	}
+}
+
+func TestLoadClassRules(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rules.yaml")
+	rules := `
+- class: backup
+  extensions: [gz, ".ZIP"]
+- class: admin
+  contains: ["/Admin"]
+`
+	if err := os.WriteFile(filename, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	classes, err := loadClassRules(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/backup.tar.gz", "backup"},
+		{"https://example.com/site.zip", "backup"},
+		{"https://example.com/admin/users", "admin"},
+		// The file replaces the built-in rules rather than adding to them
+		{"https://example.com/api/users", "other"},
+	}
+	for _, tt := range tests {
+		if got := classes.classify(tt.url, false); got != tt.want {
+			t.Errorf("classify(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
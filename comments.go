@@ -0,0 +1,68 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// commentContext is how many characters around a match are kept as its context.
+const commentContext = 40
+
+// commentPattern is a kind of interesting content looked for in HTML comments.
+type commentPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// commentPatterns are checked against every HTML comment with -extract-comments-secrets.
+var commentPatterns = []commentPattern{
+	{"password", regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|pass)\s*[:=]\s*["']?[^\s"'<>]{3,}`)},
+	{"api-key", regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret(?:[_-]?key)?|access[_-]?key|auth[_-]?token|token)\s*[:=]\s*["']?[A-Za-z0-9_\-./+=]{8,}`)},
+	{"aws-key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"private-key", regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----`)},
+	{"internal-host", regexp.MustCompile(`(?i)\b(?:[a-z0-9-]+\.)+(?:internal|intranet|corp|local|lan)\b|\b(?:10\.\d{1,3}|192\.168|172\.(?:1[6-9]|2\d|3[01]))\.\d{1,3}\.\d{1,3}\b`)},
+	{"todo-url", regexp.MustCompile(`(?i)\b(?:TODO|FIXME|XXX|HACK)\b[^\n]*?(?:https?://|/)[^\s"'<>]+`)},
+}
+
+// commentFinding is a match of one of the commentPatterns.
+type commentFinding struct {
+	kind    string
+	match   string
+	context string
+}
+
+// scanComment returns the matches of the commentPatterns in a comment, each
+// with up to commentContext characters either side, whitespace collapsed.
+func scanComment(comment string) []commentFinding {
+	var findings []commentFinding
+	for _, p := range commentPatterns {
+		for _, loc := range p.re.FindAllStringIndex(comment, -1) {
+			start := loc[0] - commentContext
+			if start < 0 {
+				start = 0
+			}
+			end := loc[1] + commentContext
+			if end > len(comment) {
+				end = len(comment)
+			}
+			// Move the bounds off any multi-byte character they landed inside
+			for start > 0 && !isRuneStart(comment[start]) {
+				start--
+			}
+			for end < len(comment) && !isRuneStart(comment[end]) {
+				end++
+			}
+			findings = append(findings, commentFinding{
+				kind:    p.kind,
+				match:   comment[loc[0]:loc[1]],
+				context: strings.Join(strings.Fields(comment[start:end]), " "),
+			})
+		}
+	}
+	return findings
+}
+
+// isRuneStart reports whether b begins a UTF-8 encoded character.
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
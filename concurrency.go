@@ -0,0 +1,120 @@
+package main
+
+import "sync"
+
+// autoWindow is how many of the latest target outcomes -auto-concurrency
+// looks at when deciding whether to change the number of workers.
+const autoWindow = 20
+
+// aimdLimit adapts how many targets are processed at once for
+// -auto-concurrency. It keeps the outcomes of the last window targets and,
+// every window/2 outcomes, adds a worker if the share of failures in the
+// window is at most threshold, or halves the number of workers if it is
+// higher (additive increase, multiplicative decrease). The limit starts at
+// floor and never leaves [floor, ceiling].
+type aimdLimit struct {
+	floor, ceiling int
+	threshold      float64
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	// outcomes is a ring of the latest results, true for failures
+	outcomes []bool
+	next     int
+	filled   bool
+	// sinceChange counts outcomes since the window was last evaluated
+	sinceChange int
+}
+
+func newAIMDLimit(floor, ceiling, window int, threshold float64) *aimdLimit {
+	if floor < 1 {
+		floor = 1
+	}
+	if ceiling < floor {
+		ceiling = floor
+	}
+	l := &aimdLimit{floor: floor, ceiling: ceiling, threshold: threshold, limit: floor, outcomes: make([]bool, window)}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits until fewer than the current limit of targets are in progress.
+func (l *aimdLimit) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+// release gives back a slot taken with acquire without recording an outcome.
+func (l *aimdLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Broadcast()
+}
+
+// done gives back a slot and records whether the target failed. It returns
+// the limit before and after, which differ when the outcome changed it.
+func (l *aimdLimit) done(failed bool) (int, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	from, to := l.observe(failed)
+	l.cond.Broadcast()
+	return from, to
+}
+
+// observe records an outcome and adjusts the limit; l.mu must be held.
+func (l *aimdLimit) observe(failed bool) (int, int) {
+	from := l.limit
+	l.outcomes[l.next] = failed
+	l.next = (l.next + 1) % len(l.outcomes)
+	if l.next == 0 {
+		l.filled = true
+	}
+	l.sinceChange++
+
+	step := len(l.outcomes) / 2
+	if step < 1 {
+		step = 1
+	}
+	if !l.filled || l.sinceChange < step {
+		return from, from
+	}
+	l.sinceChange = 0
+
+	if l.errorRate() <= l.threshold {
+		if l.limit < l.ceiling {
+			l.limit++
+		}
+	} else {
+		l.limit /= 2
+		if l.limit < l.floor {
+			l.limit = l.floor
+		}
+	}
+	return from, l.limit
+}
+
+// errorRate returns the share of failures among the outcomes kept; l.mu must be held.
+func (l *aimdLimit) errorRate() float64 {
+	failures := 0
+	for _, failed := range l.outcomes {
+		if failed {
+			failures++
+		}
+	}
+	return float64(failures) / float64(len(l.outcomes))
+}
+
+// rate returns the current share of failures in the window.
+func (l *aimdLimit) rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.errorRate()
+}
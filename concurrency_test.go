@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewAIMDLimitBounds(t *testing.T) {
+	l := newAIMDLimit(0, 0, 4, 0.1)
+	if l.floor != 1 || l.ceiling != 1 || l.limit != 1 {
+		t.Errorf("floor, ceiling, limit = %d, %d, %d, want 1, 1, 1", l.floor, l.ceiling, l.limit)
+	}
+	l = newAIMDLimit(5, 2, 4, 0.1)
+	if l.floor != 5 || l.ceiling != 5 || l.limit != 5 {
+		t.Errorf("floor, ceiling, limit = %d, %d, %d, want 5, 5, 5", l.floor, l.ceiling, l.limit)
+	}
+}
+
+func TestAIMDLimitSteps(t *testing.T) {
+	// A window of 4 is evaluated once full and then every 2 outcomes
+	l := newAIMDLimit(2, 6, 4, 0.25)
+	steps := []struct {
+		failed bool
+		limit  int
+	}{
+		{false, 2}, {false, 2}, {false, 2},
+		{false, 3}, // window full, no failures
+		{false, 3},
+		{true, 4}, // 1 of 4 failed, at the threshold
+		{true, 4},
+		{false, 2}, // 2 of 4 failed, halved
+		{false, 2},
+		{false, 3}, // 1 of 4 failed
+		{true, 3},
+		{true, 2}, // 2 of 4 failed, halved to 1 but held at the floor
+		{false, 2},
+		{false, 2}, // still 2 of 4 failed
+		{false, 2},
+		{false, 3},
+		{false, 3},
+		{false, 4},
+		{false, 4},
+		{false, 5},
+		{false, 5},
+		{false, 6},
+		{false, 6},
+		{false, 6}, // held at the ceiling
+	}
+	for i, step := range steps {
+		l.acquire()
+		if _, to := l.done(step.failed); to != step.limit {
+			t.Fatalf("outcome %d (failed %v): limit %d, want %d", i, step.failed, to, step.limit)
+		}
+	}
+}
+
+// TestAIMDLimitConverges simulates a server that fails every request made
+// while more than capacity are in progress, and checks that the limit
+// settles around the capacity instead of running away to the ceiling.
+func TestAIMDLimitConverges(t *testing.T) {
+	const capacity, ceiling = 8, 50
+	l := newAIMDLimit(1, ceiling, autoWindow, 0.1)
+	reached, peak, sum := false, 0, 0
+	for i := 0; i < 2000; i++ {
+		load := l.limit
+		l.acquire()
+		_, to := l.done(load > capacity)
+		if to >= capacity {
+			reached = true
+		}
+		if i >= 1000 {
+			sum += to
+			if to > peak {
+				peak = to
+			}
+		}
+	}
+	if !reached {
+		t.Fatalf("limit never reached the capacity of %d, ended at %d", capacity, l.limit)
+	}
+	// Every step past the capacity is backed off from within a window
+	if peak > capacity+1 {
+		t.Errorf("limit peaked at %d, above the capacity of %d", peak, capacity)
+	}
+	if mean := float64(sum) / 1000; mean < capacity/4 {
+		t.Errorf("mean limit %.1f, too far below the capacity of %d", mean, capacity)
+	}
+}
+
+// TestAIMDLimitCapsWorkers runs more workers than the limit allows against a
+// workload that always fails, and checks that no more than the floor ever run
+// at once.
+func TestAIMDLimitCapsWorkers(t *testing.T) {
+	const floor, workers, targets = 3, 12, 300
+	l := newAIMDLimit(floor, workers, autoWindow, 0.1)
+	var (
+		wg                sync.WaitGroup
+		active, maxActive int64
+		remaining         = int64(targets)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				l.acquire()
+				if atomic.AddInt64(&remaining, -1) < 0 {
+					l.release()
+					return
+				}
+				n := atomic.AddInt64(&active, 1)
+				for {
+					max := atomic.LoadInt64(&maxActive)
+					if n <= max || atomic.CompareAndSwapInt64(&maxActive, max, n) {
+						break
+					}
+				}
+				time.Sleep(100 * time.Microsecond)
+				atomic.AddInt64(&active, -1)
+				l.done(true)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxActive > floor {
+		t.Errorf("%d targets ran at once, want at most %d", maxActive, floor)
+	}
+	if l.limit != floor || l.rate() != 1 {
+		t.Errorf("limit %d at error rate %.2f, want %d at 1", l.limit, l.rate(), floor)
+	}
+}
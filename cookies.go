@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpOnlyPrefix marks HttpOnly cookies in files exported by curl and browser extensions.
+const httpOnlyPrefix = "#HttpOnly_"
+
+// loadCookieJar reads a Netscape/Mozilla cookies.txt file into a new cookie jar.
+// Each line holds seven tab-separated fields: domain, include-subdomains flag,
+// path, secure flag, expiry as a Unix timestamp (0 for session cookies), name
+// and value. Blank lines and comments are ignored, and so are expired cookies.
+func loadCookieJar(filename string) (*cookiejar.Jar, int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	loaded := 0
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		if httpOnly {
+			line = strings.TrimPrefix(line, httpOnlyPrefix)
+		} else if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, 0, fmt.Errorf("line %d: expected 7 tab-separated fields, got %d", lineNum, len(fields))
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: invalid expiry %q", lineNum, fields[4])
+		}
+
+		domain := strings.ToLower(fields[0])
+		host := strings.TrimPrefix(domain, ".")
+		secure := strings.EqualFold(fields[3], "TRUE")
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   secure,
+			HttpOnly: httpOnly,
+		}
+		// A cookie is host-only unless it also applies to subdomains
+		if strings.EqualFold(fields[1], "TRUE") {
+			cookie.Domain = host
+		}
+		if expiry != 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+			if cookie.Expires.Before(now) {
+				continue
+			}
+		}
+
+		scheme := "http"
+		if secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: cookie.Path}, []*http.Cookie{cookie})
+		loaded++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return jar, loaded, nil
+}
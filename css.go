@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	// cssURL matches url(...) references, with or without quotes
+	cssURL = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)['"]?\s*\)`)
+	// cssImport matches @import rules that use a bare string rather than url(...)
+	cssImport = regexp.MustCompile(`@import\s+['"]([^'"]+)['"]`)
+)
+
+// fetchCSSLinks downloads the stylesheet at u, reading at most maxBody bytes,
+// and returns the URLs it references resolved against the stylesheet's URL.
+func fetchCSSLinks(ctx context.Context, client *http.Client, u, userAgent string, maxBody int64) ([]string, error) {
+	data, err := fetchBody(ctx, client, u, userAgent, maxBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []string
+	for _, ref := range extractCSSLinks(string(data)) {
+		if link, err := resolveLink(u, ref); err == nil {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+// extractCSSLinks returns the url(...) and @import targets found in a stylesheet,
+// skipping inline data: URIs.
+func extractCSSLinks(css string) []string {
+	var links []string
+	for _, re := range []*regexp.Regexp{cssURL, cssImport} {
+		for _, m := range re.FindAllStringSubmatch(css, -1) {
+			if !strings.HasPrefix(strings.ToLower(m[1]), "data:") {
+				links = append(links, m[1])
+			}
+		}
+	}
+	return links
+}
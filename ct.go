@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ctLogURL is the crt.sh search returning every logged certificate for a domain as JSON.
+const ctLogURL = "https://crt.sh/?output=json&q="
+
+// ctMaxBody caps the crt.sh response, which can be large for busy domains.
+const ctMaxBody = 64 << 20
+
+// ctEntry is the part of a crt.sh result that names the certificate's hosts.
+type ctEntry struct {
+	CommonName string `json:"common_name"`
+	// NameValue holds the certificate's names separated by newlines
+	NameValue string `json:"name_value"`
+}
+
+// ctSubdomains queries the Certificate Transparency logs through crt.sh and
+// returns the sorted hostnames under domain that certificates were issued for.
+// Wildcard names contribute the domain they cover.
+func ctSubdomains(ctx context.Context, client *http.Client, domain, userAgent string) ([]string, error) {
+	data, err := fetchBody(ctx, client, ctLogURL+url.QueryEscape("%."+domain), userAgent, ctMaxBody)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ctEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	for _, entry := range entries {
+		for _, name := range strings.Split(entry.NameValue+"\n"+entry.CommonName, "\n") {
+			name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "*.")
+			if name != "" && inScope(name, domain) {
+				seen[name] = struct{}{}
+			}
+		}
+	}
+	hosts := make([]string, 0, len(seen))
+	for host := range seen {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// apexDomain returns the registrable domain of hostname, e.g. example.com for
+// www.api.example.com. Without a public suffix list it treats a short second
+// level under a two-letter TLD (co.uk, com.au) as part of the suffix.
+// IP addresses have no apex domain and yield "".
+func apexDomain(hostname string) string {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if net.ParseIP(strings.Trim(hostname, "[]")) != nil {
+		return ""
+	}
+	labels := strings.Split(hostname, ".")
+	if len(labels) < 2 {
+		return ""
+	}
+	n := 2
+	if len(labels) > 2 && len(labels[len(labels)-1]) == 2 && len(labels[len(labels)-2]) <= 3 {
+		n = 3
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// dumpRecord describes a response saved by -dump-dir. It is stored as
+// <sha1 of url>.json next to the body, which is stored as <sha1 of url>.body.
+type dumpRecord struct {
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Time   time.Time   `json:"time"`
+}
+
+// dumpName returns the file name, without extension, of the dump of u.
+func dumpName(u string) string {
+	sum := sha1.Sum([]byte(u))
+	return hex.EncodeToString(sum[:])
+}
+
+// dumpTransport wraps a RoundTripper for -dump-dir, saving every GET response,
+// redirects and PDF/CSS/script fetches included, so that -replay-dir can run
+// the extraction again later. Only the part of the body that was read is
+// saved, which is what the extraction saw.
+type dumpTransport struct {
+	next   http.RoundTripper
+	dir    string
+	errors int64
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet {
+		return resp, err
+	}
+	record := dumpRecord{URL: req.URL.String(), Status: resp.StatusCode, Header: resp.Header.Clone(), Time: time.Now()}
+	resp.Body = &dumpBody{ReadCloser: resp.Body, save: func(body []byte) {
+		if err := t.save(record, body); err != nil && atomic.AddInt64(&t.errors, 1) == 1 {
+			fmt.Fprintln(logOutput, color.YellowString("Warning: Could not write to -dump-dir:"), err)
+		}
+	}}
+	return resp, nil
+}
+
+// save writes the body before the record, so that a record always has its body.
+func (t *dumpTransport) save(record dumpRecord, body []byte) error {
+	name := filepath.Join(t.dir, dumpName(record.URL))
+	if err := os.WriteFile(name+".body", body, 0644); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name+".json", data, 0644)
+}
+
+// dumpBody copies what is read from a response body and saves it on Close.
+type dumpBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	save func([]byte)
+	once sync.Once
+}
+
+func (b *dumpBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+func (b *dumpBody) Close() error {
+	b.once.Do(func() { b.save(b.buf.Bytes()) })
+	return b.ReadCloser.Close()
+}
+
+// replayTransport answers requests from a -dump-dir directory for -replay-dir,
+// without any network access. URLs that weren't dumped fail.
+type replayTransport struct {
+	dir     string
+	records map[string]dumpRecord
+}
+
+// loadReplay reads the records in dir, saved there by -dump-dir.
+func loadReplay(dir string) (*replayTransport, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	t := &replayTransport{dir: dir, records: make(map[string]dumpRecord)}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		var record dumpRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		t.records[record.URL] = record
+	}
+	if len(t.records) == 0 {
+		return nil, fmt.Errorf("no dumped responses in %s", dir)
+	}
+	return t, nil
+}
+
+// pages returns the URLs of the dumped HTML pages, which are the targets when
+// -replay-dir is given without -u or -l.
+func (t *replayTransport) pages() []string {
+	var urls []string
+	for u, record := range t.records {
+		if record.Status != http.StatusOK {
+			continue
+		}
+		if ct := record.Header.Get("Content-Type"); ct != "" {
+			if mediaType, _, err := mime.ParseMediaType(ct); err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+				continue
+			}
+		}
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	u := req.URL.String()
+	record, ok := t.records[u]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in the replay directory", u)
+	}
+	body, err := os.ReadFile(filepath.Join(t.dir, dumpName(u)+".body"))
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(body))
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+	header := record.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	// The body may have been cut short by -max-body when it was dumped
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        strings.TrimSpace(fmt.Sprintf("%d %s", record.Status, http.StatusText(record.Status))),
+		StatusCode:    record.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: size,
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+	"github.com/fatih/color"
+)
+
+// esSink bulk-indexes extracted URLs into Elasticsearch as they are found.
+// Documents are keyed by the SHA-1 of their URL, so a URL found again, in this
+// run or a later one, replaces its earlier document instead of duplicating it.
+type esSink struct {
+	indexer esutil.BulkIndexer
+	// failed counts documents Elasticsearch didn't accept
+	failed int64
+}
+
+// newESSink connects to the comma-separated Elasticsearch addresses and
+// starts a bulk indexer for index.
+func newESSink(addrs, index string) (*esSink, error) {
+	var addresses []string
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addresses = append(addresses, addr)
+		}
+	}
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: addresses})
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Info()
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("unexpected response: %s", res.Status())
+	}
+
+	e := &esSink{}
+	e.indexer, err = esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:        client,
+		Index:         index,
+		FlushInterval: 5 * time.Second,
+		OnError: func(_ context.Context, err error) {
+			e.fail(err)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// fail counts a rejected document, warning about the first one.
+func (e *esSink) fail(err error) {
+	if atomic.AddInt64(&e.failed, 1) == 1 {
+		fmt.Fprintln(logOutput, color.YellowString("Warning: Could not index in Elasticsearch:"), err)
+	}
+}
+
+// index queues result for indexing. A nil sink does nothing.
+func (e *esSink) index(result urlResult) {
+	if e == nil {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	id := sha1.Sum([]byte(result.URL))
+	err = e.indexer.Add(context.Background(), esutil.BulkIndexerItem{
+		Action:     "index",
+		DocumentID: hex.EncodeToString(id[:]),
+		Body:       bytes.NewReader(data),
+		OnFailure: func(_ context.Context, _ esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			if err == nil {
+				err = fmt.Errorf("%s: %s", res.Error.Type, res.Error.Reason)
+			}
+			e.fail(err)
+		},
+	})
+	if err != nil {
+		e.fail(err)
+	}
+}
+
+// Close flushes the queued documents and returns how many of all those
+// indexed were rejected. A nil sink does nothing.
+func (e *esSink) Close() int64 {
+	if e == nil {
+		return 0
+	}
+	if err := e.indexer.Close(context.Background()); err != nil {
+		e.fail(err)
+	}
+	return atomic.LoadInt64(&e.failed)
+}
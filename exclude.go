@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// excludeList holds the already-tested URLs loaded with -exclude-file, which
+// are suppressed from every output. Lookups only probe maps, so matching stays
+// proportional to the length of the URL however long the file is.
+type excludeList struct {
+	// urls are excluded exactly
+	urls map[string]struct{}
+	// segments exclude the URLs equal to them or continuing them with a new
+	// path segment, query or fragment, from lines ending in *
+	segments map[string]struct{}
+	// prefixes exclude every URL starting with them, from lines ending in **
+	prefixes map[string]struct{}
+}
+
+// loadExcludeList reads an exclusion file. Each line is a URL, excluded
+// exactly, or a URL followed by * or **. With *, the prefix only matches
+// whole path segments: https://example.com/admin* excludes /admin, /admin/users
+// and /admin?x=1 but not /administrators, while https://example.com/admin**
+// excludes all of them. Blank lines and lines starting with # are ignored.
+func loadExcludeList(filename string) (*excludeList, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	l := &excludeList{
+		urls:     make(map[string]struct{}),
+		segments: make(map[string]struct{}),
+		prefixes: make(map[string]struct{}),
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasSuffix(line, "**"):
+			l.prefixes[strings.TrimSuffix(line, "**")] = struct{}{}
+		case strings.HasSuffix(line, "*"):
+			l.segments[strings.TrimSuffix(line, "*")] = struct{}{}
+		default:
+			l.urls[line] = struct{}{}
+		}
+	}
+	return l, scanner.Err()
+}
+
+// isSegmentBoundary reports whether c starts a new path segment, the query or the fragment.
+func isSegmentBoundary(c byte) bool {
+	return c == '/' || c == '?' || c == '#'
+}
+
+// matches reports whether u is excluded. A nil excludeList excludes nothing.
+func (l *excludeList) matches(u string) bool {
+	if l == nil {
+		return false
+	}
+	if _, ok := l.urls[u]; ok {
+		return true
+	}
+	if _, ok := l.segments[u]; ok {
+		return true
+	}
+	for i := 1; i <= len(u); i++ {
+		if len(l.prefixes) > 0 {
+			if _, ok := l.prefixes[u[:i]]; ok {
+				return true
+			}
+		}
+		if i < len(u) && isSegmentBoundary(u[i]) {
+			// Both "…/admin*" and "…/admin/*" cover "…/admin/users"
+			if _, ok := l.segments[u[:i]]; ok {
+				return true
+			}
+			if _, ok := l.segments[u[:i+1]]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// size returns the number of entries in the list.
+func (l *excludeList) size() int {
+	return len(l.urls) + len(l.segments) + len(l.prefixes)
+}
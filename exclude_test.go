@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeExcludeList writes lines to an exclusion file and loads it.
+func writeExcludeList(t testing.TB, lines string) *excludeList {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "exclude.txt")
+	if err := os.WriteFile(filename, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := loadExcludeList(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestExcludeListMatches(t *testing.T) {
+	l := writeExcludeList(t, `
+# tested last week
+https://example.com/login
+  https://example.com/admin*
+https://example.com/api/*
+https://example.com/static**
+`)
+	if l.size() != 4 {
+		t.Errorf("size = %d, want 4", l.size())
+	}
+	tests := []struct {
+		u    string
+		want bool
+	}{
+		{"https://example.com/login", true},
+		{"https://example.com/login/", false},
+		{"https://example.com/login?next=/", false},
+		{"https://example.com/admin", true},
+		{"https://example.com/admin/users", true},
+		{"https://example.com/admin?x=1", true},
+		{"https://example.com/admin#top", true},
+		{"https://example.com/administrators", false},
+		{"https://example.com/api/", true},
+		{"https://example.com/api/v1/users", true},
+		{"https://example.com/api", false},
+		{"https://example.com/apiary", false},
+		{"https://example.com/static", true},
+		{"https://example.com/statics/x.js", true},
+		{"https://example.com/", false},
+		{"https://other.com/admin", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := l.matches(tt.u); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.u, got, tt.want)
+		}
+	}
+
+	var none *excludeList
+	if none.matches("https://example.com/login") {
+		t.Error("a nil list matched")
+	}
+}
+
+func TestExcludeListLongLine(t *testing.T) {
+	long := "https://example.com/" + strings.Repeat("a", 200*1024)
+	l := writeExcludeList(t, long+"\n")
+	if !l.matches(long) {
+		t.Error("a 200KB line wasn't loaded")
+	}
+}
+
+// TestExcludeFileOutputs checks that excluded URLs stay out of the side
+// outputs too, not only the main one.
+func TestExcludeFileOutputs(t *testing.T) {
+	long := "/" + strings.Repeat("x", 100)
+	srv := serveSite(t, map[string]string{
+		"/": `<a href="/keep/page?id=1">keep</a>
+<a href="/tested/page?token=1">tested</a>
+<a href="` + long + `">long</a>
+<a href="/tested` + long + `">tested long</a>
+<a href="https://kept.example.net/" target="_blank">kept</a>
+<a href="https://tested.example.net/" target="_blank">tested</a>
+<form action="/keep/form"><input name="kept_field"></form>
+<form action="/tested/form"><input name="tested_field"></form>`,
+	})
+	dir := t.TempDir()
+	exclude := filepath.Join(dir, "exclude.txt")
+	if err := os.WriteFile(exclude, []byte(srv.URL+"/tested*\nhttps://tested.example.net/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	longOut, blankOut, words, params := filepath.Join(dir, "long.txt"), filepath.Join(dir, "blank.txt"), filepath.Join(dir, "words.txt"), filepath.Join(dir, "params.txt")
+	got := runGetends(t, "-u", srv.URL+"/", "-exclude-file", exclude, "-max-url-length", "80",
+		"-long-out", longOut, "-blank-links-out", blankOut, "-wordlist", words, "-param-wordlist", params)
+
+	for _, tt := range []struct {
+		name      string
+		got, want []string
+	}{
+		{"output", got, []string{srv.URL + "/keep/page?id=1", srv.URL + "/keep/form"}},
+		{"-long-out", readLines(t, longOut), []string{srv.URL + long}},
+		{"-blank-links-out", readLines(t, blankOut), []string{"https://kept.example.net/"}},
+		{"-wordlist", readLines(t, words), []string{"keep", "page", "form"}},
+		{"-param-wordlist", readLines(t, params), []string{"id", "kept_field"}},
+	} {
+		if !sameURLs(tt.got, tt.want) {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// BenchmarkExcludeListMatches matches URLs against a list of 100,000 entries,
+// which should cost about as much as against a list of ten.
+func BenchmarkExcludeListMatches(b *testing.B) {
+	var lines strings.Builder
+	for i := 0; i < 100000; i++ {
+		switch i % 3 {
+		case 0:
+			fmt.Fprintf(&lines, "https://example.com/page/%d\n", i)
+		case 1:
+			fmt.Fprintf(&lines, "https://example.com/section%d*\n", i)
+		case 2:
+			fmt.Fprintf(&lines, "https://cdn%d.example.com/**\n", i)
+		}
+	}
+	l := writeExcludeList(b, lines.String())
+	urls := []string{
+		"https://example.com/page/99999",
+		"https://example.com/section4/deeper/path?q=1",
+		"https://example.com/not/listed/at/all/with/a/longer/path?and=query#fragment",
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.matches(urls[i%len(urls)])
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "time"
+
+// exportedState is the snapshot of a finished crawl written by -export-state.
+type exportedState struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Seeds are the targets the crawl started from, after any expansion
+	Seeds     []string         `json:"seeds"`
+	Targets   []exportedTarget `json:"targets"`
+	Extracted []exportedURL    `json:"extracted"`
+	Stats     exportedStats    `json:"stats"`
+}
+
+// exportedTarget is a target that was fetched, with the outcome of the fetch.
+type exportedTarget struct {
+	URL         string    `json:"url"`
+	Depth       int       `json:"depth"`
+	Status      int       `json:"status,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Time        time.Time `json:"fetched_at"`
+}
+
+// exportedURL is an extracted URL. Depth is one more than the depth of the
+// target it was found on; Status and ContentType are only known for URLs
+// that were fetched as targets themselves. URLs restored from -state have
+// nothing but the URL.
+type exportedURL struct {
+	urlResult
+	Depth       int    `json:"depth"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// exportedStats summarizes the crawl.
+type exportedStats struct {
+	Seeds     int `json:"seeds"`
+	Targets   int `json:"targets"`
+	Failed    int `json:"failed"`
+	Extracted int `json:"extracted"`
+	External  int `json:"external"`
+	// Seconds is how long the crawl took
+	Seconds float64 `json:"seconds"`
+}
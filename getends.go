@@ -2,48 +2,88 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/andybalholm/cascadia"
 	"github.com/fatih/color"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 	"golang.org/x/net/html"
+	"golang.org/x/net/proxy"
+	"golang.org/x/time/rate"
 )
 
+// dnsServers is the ordered list of DNS servers the customResolver will try.
+// It defaults to Cloudflare with a fallback to Google and can be overridden with -dns.
+var dnsServers = []string{"1.1.1.1:53", "8.8.8.8:53"}
+
 // The customResolver will be a public DNS resolver (Cloudflare)
 // We will use this in a custom http.Transport.
 var customResolver = &net.Resolver{
 	PreferGo: true,
 	Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-		// Try Cloudflare DNS (1.1.1.1) first
 		d := net.Dialer{
 			Timeout: 10 * time.Second,
 		}
-		conn, err := d.DialContext(ctx, "udp", "1.1.1.1:53")
-		if err == nil {
-			return conn, nil
+		// Try each DNS server in order, moving to the next one only on error
+		var lastErr error
+		for _, server := range dnsServers {
+			conn, err := d.DialContext(ctx, "udp", server)
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
 		}
-		// If Cloudflare fails, fall back to Google DNS (8.8.8.8)
-		return d.DialContext(ctx, "udp", "8.8.8.8:53")
+		return nil, lastErr
 	},
 }
 
+// hostsFilePath is the hosts file consulted when -use-hosts-file is set.
+const hostsFilePath = "/etc/hosts"
+
+// dialFunc is the signature of http.Transport.DialContext.
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// outputTailSize is how much of the end of the output file is re-read under
+// -lock-output to find URLs that another process has just written.
+const outputTailSize = 1 << 20
+
+// logOutput receives the banner and progress messages. It is switched to
+// stderr when the extracted URLs themselves are written to stdout with -o -.
+var logOutput io.Writer = os.Stdout
+
+// snippetLength caps the visible text kept per page for -store-headers, in characters.
+var snippetLength = 200
+
+// errRedirectLoop classifies redirect chains that revisit a URL.
+var errRedirectLoop = errors.New("redirect-loop")
+
 func main() {
-	fmt.Println(`
-       __  ____      __
- ___ ____ / /_/ __/__  ___/ /__
- / _  / -_) __/ _// _  / _  (_-<
- \_, /\__/\__/___/_//_/\_,_/___/
- /___/   - Links Extractor      
-    `)
 	var (
 		singleURL   string
 		listFile    string
@@ -51,21 +91,423 @@ func main() {
 		sameDomain  bool
 		jsOnly      bool
 		noAccept    bool
+		dnsList     string
+		tee         bool
+		useHosts    bool
+		scopeFrom   string
+		socksProxy  string
+		noPrivate   bool
+		lockOutput  bool
+		minJSSize   int64
+		maxURLLen   int
+		keepLong    bool
+		longOut     string
+		maxIdle     int
+		canonical   bool
+		tlsTimeout  time.Duration
+		pdfMode     bool
+		maxBody     int64
+		maxRedir    int
+		hdrTimeout  time.Duration
+		verbose     bool
+		matchList   string
+		exclList    string
+		downOut     string
+		smartSch    bool
+		headersOut  string
+		overFile    string
+		dryRun      bool
+		parseCSS    bool
+		keepSPA     bool
+		noDedup     bool
+		wordOut     string
+		compress    bool
+		maxOutStr   string
+		concurrency int
+		cHTTP       int
+		cHTTPS      int
+		hashOut     string
+		changeDist  int
+		scopeSel    string
+		traceReqs   bool
+		blockFile   string
+		noTrackers  bool
+		trackFile   string
+		extLimit    int
+		stateFile   string
+		certHosts   bool
+		certOut     string
+		crawlExcl   stringList
+		depthCaps   stringList
+		rewrites    stringList
+		outRewrites stringList
+		expandWild  bool
+		subWords    string
+		graphOut    string
+		ctLogs      bool
+		asnList     string
+		asnMaxIPs   int
+		verifyTLS   bool
+		skipTLS     string
+		classify    bool
+		classFile   string
+		useShodan   bool
+		shodanKey   string
+		tgtBudget   time.Duration
+		redisURL    string
+		redisKey    string
+		useHTTP3    bool
+		cookieJar   string
+		kafkaAddrs  string
+		kafkaTopic  string
+		bodyOnly    bool
+		blankOut    string
+		esAddrs     string
+		esIndex     string
+		commentScan bool
+		scanJS      bool
+		jsWorkers   int
+		jsBudget    time.Duration
+		preCheck    bool
+		preTimeout  time.Duration
+		sourceIP    string
+		ifaceName   string
+		wwwVariants bool
+		strictParse bool
+		autoConc    bool
+		autoFloor   int
+		autoErrRate float64
+		maxHosts    int
+		detectPush  bool
+		dumpDir     string
+		replayDir   string
+		countOut    bool
+		sortByCount bool
+		hintsOut    string
+		noHints     bool
+		hintsMaxAge time.Duration
+		burst       int
+		exportOut   string
+		extraAttr   stringList
+		knownFile   string
+		showKnown   bool
+		exclFile    string
+		dedupeSize  bool
+		sortedOut   bool
+		retryDNS    int
+		retryConn   int
+		retryTLS    int
+		retryHTTP   int
+		scopeFile   string
+		paramOut    string
+		metaRobots  bool
+		metricsAddr string
+		bodyTime    time.Duration
+		normWWW     bool
+		acceptLang  string
+		probeLocs   string
+		crawlIfrm   bool
 	)
 
 	flag.StringVar(&singleURL, "u", "", "Single URL to fetch")
 	flag.StringVar(&listFile, "l", "", "Text file containing a list of URLs")
-	flag.StringVar(&outputFile, "o", "extracted.txt", "Output file to write extracted URLs")
+	flag.StringVar(&outputFile, "o", "extracted.txt", "Output file to write extracted URLs (- for stdout)")
 	flag.BoolVar(&sameDomain, "d", false, "Extract only links on the same domain as the target")
 	flag.BoolVar(&jsOnly, "j", false, "Extract only .js files")
 	flag.BoolVar(&noAccept, "no-accept", false, "Do not send the Accept header")
+	flag.StringVar(&dnsList, "dns", strings.Join(dnsServers, ","), "Comma-separated list of DNS servers to try in order")
+	flag.BoolVar(&tee, "tee", false, "Also write the final list of extracted URLs to stdout (no color)")
+	flag.BoolVar(&useHosts, "use-hosts-file", false, "Check /etc/hosts before querying DNS")
+	flag.StringVar(&scopeFrom, "scope-origin", "original", "Host to scope links against after redirects: original or final")
+	flag.StringVar(&socksProxy, "socks5", "", "SOCKS5 proxy to route requests through ([user:pass@]host:port)")
+	flag.BoolVar(&noPrivate, "block-private", false, "Refuse connections to private, loopback and link-local addresses")
+	flag.BoolVar(&lockOutput, "lock-output", false, "Lock the output file while writing and skip URLs another process just wrote")
+	flag.Int64Var(&minJSSize, "min-js-size", 0, "In -j mode, drop .js files smaller than this many bytes")
+	flag.IntVar(&maxURLLen, "max-url-length", 2048, "Drop URLs longer than this many characters")
+	flag.BoolVar(&keepLong, "keep-long", false, "Keep URLs longer than -max-url-length")
+	flag.StringVar(&longOut, "long-out", "", "File to write URLs dropped by -max-url-length")
+	flag.IntVar(&maxIdle, "max-idle-conns", 0, "Maximum idle connections to keep per host (0 uses the Go default)")
+	flag.BoolVar(&canonical, "follow-canonical", false, "Also process in-scope <link rel=\"canonical\"> URLs")
+	flag.DurationVar(&tlsTimeout, "tls-timeout", 0, "Timeout for the TLS handshake (0 leaves it bounded only by the overall timeout)")
+	flag.BoolVar(&pdfMode, "pdf", false, "Keep .pdf links and extract the URLs inside in-scope PDFs")
+	flag.Int64Var(&maxBody, "max-body", 10<<20, "Maximum number of bytes to read from each response body")
+	flag.IntVar(&maxRedir, "max-redirects", 10, "Maximum number of redirects to follow (0 reports the Location without following)")
+	flag.DurationVar(&hdrTimeout, "header-timeout", 0, "Timeout waiting for response headers after the request is sent (0 leaves it bounded only by the overall timeout)")
+	flag.BoolVar(&verbose, "v", false, "Verbose output")
+	flag.StringVar(&matchList, "match-codes", "200", "Comma-separated response status codes to extract links from")
+	flag.StringVar(&exclList, "exclude-codes", "", "Comma-separated response status codes to skip (takes precedence over -match-codes)")
+	flag.StringVar(&downOut, "downgrades-out", "", "File to write redirect chains that downgrade from https to http")
+	flag.BoolVar(&smartSch, "smart-scheme", false, "Try https:// first for targets without a scheme, falling back to http:// on TLS errors or timeouts")
+	flag.StringVar(&headersOut, "store-headers", "", "File to write selected response headers for each target (JSON lines)")
+	flag.StringVar(&overFile, "overrides", "", "YAML file of per-domain junk, exclude and rate limit overrides")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the targets and effective per-domain configuration, then exit")
+	flag.BoolVar(&parseCSS, "parse-css", false, "Keep .css links and extract url() and @import targets from in-scope stylesheets")
+	flag.BoolVar(&keepSPA, "keep-spa-fragments", true, "Keep route-like fragments (#/ and #!/) as spa-route findings instead of stripping them")
+	flag.BoolVar(&noDedup, "no-dedup-file", false, "Append to the output file without skipping URLs it already contains")
+	flag.StringVar(&wordOut, "wordlist", "", "File to write the unique path segments of the extracted URLs to, as a wordlist")
+	flag.BoolVar(&compress, "compress-output", false, "Gzip the output file, adding .gz to the -o name if needed")
+	flag.StringVar(&maxOutStr, "max-output-size", "", "Rotate the output file to output.001.txt, output.002.txt, ... once it reaches this size (e.g. 100MB)")
+	flag.IntVar(&concurrency, "c", 1, "Number of targets to process concurrently")
+	flag.IntVar(&cHTTP, "c-http", 0, "Maximum concurrent requests to http:// targets (0 means no cap beyond -c)")
+	flag.IntVar(&cHTTPS, "c-https", 0, "Maximum concurrent requests to https:// targets (0 means no cap beyond -c)")
+	flag.StringVar(&hashOut, "hashes-out", "", "File to record a SHA-256 and simhash of each target's body in (JSON lines), reporting targets that changed since the last run")
+	flag.IntVar(&changeDist, "change-threshold", 3, "Simhash distance (in bits) above which a target is reported as changed")
+	flag.StringVar(&scopeSel, "scope-selector", "", "CSS selector limiting link extraction to matching parts of each page, e.g. \"main, article, .content\"")
+	flag.BoolVar(&traceReqs, "trace", false, "Print every request and response header block, with DNS, connection and TLS events, to stderr")
+	flag.StringVar(&blockFile, "blocklist", "", "File of out-of-scope URLs and /path prefixes to skip (# starts a comment)")
+	flag.BoolVar(&noTrackers, "no-tracker-filter", false, "Don't classify external links to analytics and tracking domains")
+	flag.StringVar(&trackFile, "tracker-list", "", "File of tracker domains to use instead of the built-in list")
+	flag.IntVar(&extLimit, "limit-per-ext", 0, "Keep at most this many new URLs of each extension per source page (0 disables the cap)")
+	flag.StringVar(&stateFile, "state", "", "File to save crawl progress to periodically and on Ctrl+C; rerunning with the same file resumes the crawl")
+	flag.BoolVar(&certHosts, "domains-from-certs", false, "Report hostnames found in the Subject Alternative Names of TLS certificates")
+	flag.StringVar(&certOut, "cert-domains-out", "", "File to write the hostnames found with -domains-from-certs to")
+	flag.Var(&crawlExcl, "crawl-exclude", "Regex of URLs to record but never follow (repeatable)")
+	flag.Var(&depthCaps, "depth-cap", "pattern:depth limiting how deep URLs matching the regex are followed, e.g. /calendar/:1 (repeatable)")
+	flag.Var(&rewrites, "rewrite", "Rewrite rule s|pattern|replacement| applied to URLs before deduplication (repeatable, applied in order)")
+	flag.Var(&outRewrites, "rewrite-output", "Rewrite rule s|pattern|replacement| applied to the URLs written out (repeatable, applied in order)")
+	flag.BoolVar(&expandWild, "expand-wildcards", false, "Expand *.example.com targets into subdomains found through NS, MX and a DNS brute force")
+	flag.StringVar(&subWords, "subdomain-wordlist", "", "Wordlist to brute force subdomains with for -expand-wildcards instead of the built-in list")
+	flag.StringVar(&graphOut, "link-graph", "", "File to write a JSON index of the source pages linking to each extracted URL to")
+	flag.BoolVar(&ctLogs, "ct-logs", false, "Add subdomains of each target's apex domain found in Certificate Transparency logs (crt.sh)")
+	flag.StringVar(&asnList, "asn", "", "Comma-separated ASNs (e.g. AS12345) whose announced IPv4 ranges are added as targets, using reverse DNS for hostnames")
+	flag.IntVar(&asnMaxIPs, "asn-max-ips", 65536, "Maximum number of addresses to add for each ASN")
+	flag.BoolVar(&verifyTLS, "verify-tls", false, "Verify TLS certificates instead of accepting any certificate")
+	flag.StringVar(&skipTLS, "skip-tls-hosts", "", "Comma-separated hostnames whose certificates aren't verified even with -verify-tls")
+	flag.BoolVar(&classify, "classify", false, "Prefix each output URL with its class (page, asset, api, document, external or other) and a tab")
+	flag.StringVar(&classFile, "classify-rules", "", "YAML file of classification rules replacing the built-in ones")
+	flag.BoolVar(&useShodan, "shodan", false, "Add services Shodan has seen on each target's apex domain as targets (needs -shodan-key)")
+	flag.StringVar(&shodanKey, "shodan-key", os.Getenv("SHODAN_API_KEY"), "Shodan API key (defaults to $SHODAN_API_KEY)")
+	flag.DurationVar(&tgtBudget, "target-budget", 0, "Maximum total time to spend on each target, including retries and reading the body (0 means no limit)")
+	flag.StringVar(&redisURL, "redis", "", "Redis URL (e.g. redis://127.0.0.1:6379) to RPUSH each extracted URL to as it is found")
+	flag.StringVar(&redisKey, "redis-key", "getends:results", "Redis list to push extracted URLs to with -redis")
+	flag.BoolVar(&useHTTP3, "http3", false, "Fetch https URLs over HTTP/3 (QUIC), falling back to HTTP/1.1 or HTTP/2 for hosts where it fails")
+	flag.StringVar(&cookieJar, "cookie-jar-file", "", "Netscape/Mozilla cookies.txt file to load into the cookie jar")
+	flag.IntVar(&snippetLength, "snippet-length", 200, "Maximum characters of visible page text stored as the snippet with -store-headers")
+	flag.StringVar(&kafkaAddrs, "kafka", "", "Comma-separated Kafka brokers (e.g. broker:9092) to produce each extracted URL to as JSON; replaces the output file unless -o is given")
+	flag.StringVar(&kafkaTopic, "kafka-topic", "getends-urls", "Kafka topic to produce extracted URLs to with -kafka")
+	flag.BoolVar(&bodyOnly, "body-only", false, "Drop links that only appear in the <head>, such as analytics scripts and fonts")
+	flag.StringVar(&blankOut, "blank-links-out", "", "File to write external links opened with target=_blank, often a site's third-party integrations")
+	flag.StringVar(&esAddrs, "es", "", "Comma-separated Elasticsearch URLs (e.g. http://localhost:9200) to index each extracted URL in")
+	flag.StringVar(&esIndex, "es-index", "getends", "Elasticsearch index to store extracted URLs in with -es")
+	flag.BoolVar(&commentScan, "extract-comments-secrets", false, "Scan HTML comments for passwords, API keys, internal hostnames and TODOs with URLs")
+	flag.BoolVar(&scanJS, "scan-js", false, "Fetch in-scope scripts and extract the URLs and paths quoted in them")
+	flag.IntVar(&jsWorkers, "js-concurrency", 4, "Number of scripts scanned concurrently with -scan-js, alongside the page workers")
+	flag.DurationVar(&jsBudget, "js-budget", 0, "Maximum total time spent scanning scripts with -scan-js (e.g. 5m; 0 for no limit)")
+	flag.BoolVar(&preCheck, "preflight-check", false, "Send a HEAD request to each target before crawling and drop those that time out, fail DNS or refuse the connection")
+	flag.DurationVar(&preTimeout, "preflight-timeout", 5*time.Second, "Timeout for each -preflight-check request")
+	flag.StringVar(&sourceIP, "source-ip", "", "Local IP address to send requests from, on hosts with several")
+	flag.StringVar(&ifaceName, "interface", "", "Network interface to send requests from, using its first address")
+	flag.BoolVar(&wwwVariants, "www-variants", false, "Also crawl the www. variant of naked-domain targets, and the naked domain of www. targets, when both resolve")
+	flag.BoolVar(&strictParse, "strict-parse", true, "Extract with the fast tokenizer; -strict-parse=false builds a full DOM the way a browser would, recovering links from broken markup")
+	flag.BoolVar(&autoConc, "auto-concurrency", false, "Adjust the number of concurrent targets to the error rate, between -auto-floor and -c")
+	flag.IntVar(&autoFloor, "auto-floor", 1, "Number of concurrent targets -auto-concurrency starts at and never goes below")
+	flag.Float64Var(&autoErrRate, "auto-error-rate", 0.1, "Share of failed targets (errors, timeouts, 429 and 5xx) above which -auto-concurrency backs off")
+	flag.IntVar(&maxHosts, "max-hosts", 0, "Stop following URLs on new hosts once the crawl has touched this many distinct hosts (0 for no limit)")
+	flag.BoolVar(&detectPush, "detect-h2-push", false, "Also request https targets with HTTP/2 server push enabled and extract the URLs the server pushes")
+	flag.StringVar(&dumpDir, "dump-dir", "", "Directory to save every response to, for -replay-dir")
+	flag.StringVar(&replayDir, "replay-dir", "", "Run the extraction over the responses saved by -dump-dir in this directory instead of the network (targets default to the saved pages)")
+	flag.BoolVar(&countOut, "count-output", false, "Prefix each output line with the number of pages the URL was found on")
+	flag.BoolVar(&sortByCount, "sort-by-count", false, "Sort the output by the number of pages each URL was found on, most first")
+	flag.StringVar(&hintsOut, "hints", "", "JSON file of per-host settings learned by earlier runs, applied at startup and updated at the end")
+	flag.BoolVar(&noHints, "no-hints", false, "Don't apply the -hints file, only update it")
+	flag.DurationVar(&hintsMaxAge, "hints-max-age", 7*24*time.Hour, "Ignore -hints entries not confirmed for this long (0 keeps them forever)")
+	flag.IntVar(&burst, "burst", 1, "Number of requests a host with a rate_limit override may get at once before being throttled to its rate")
+	flag.StringVar(&exportOut, "export-state", "", "File to write a JSON snapshot of the finished crawl to: seeds, fetched targets, extracted URLs with their metadata and statistics")
+	flag.StringVar(&knownFile, "known", "", "File of URLs found by earlier runs (e.g. a previous output file); URLs not in it are printed as [NEW]")
+	flag.BoolVar(&showKnown, "show-known", false, "Also print URLs found by earlier runs, dimmed, when -known or -state is used")
+	flag.Var(&extraAttr, "attr", "tag:attribute whose values are also extracted as links, e.g. div:data-endpoint, or *:attribute for any tag (repeatable)")
+	flag.StringVar(&exclFile, "exclude-file", "", "File of already-tested URLs to suppress from every output; a trailing * matches whole path segments, ** any prefix (# starts a comment)")
+	flag.BoolVar(&dedupeSize, "dedupe-by-response-size", false, "Skip extracting from responses whose status and Content-Length were already seen on the same host, a cheap and lossy near-duplicate check")
+	flag.BoolVar(&sortedOut, "output-on-the-fly-sorted", false, "Spill extracted URLs to sorted temporary runs as they are found and write the output as one sorted merge of them, bounding the memory used for sorting")
+	flag.IntVar(&retryDNS, "retries-dns", 0, "Times to retry a fetch after a DNS failure other than a nonexistent name")
+	flag.IntVar(&retryConn, "retries-connect", 2, "Times to retry a fetch after a refused, reset or timed out connection")
+	flag.IntVar(&retryTLS, "retries-tls", 1, "Times to retry a fetch after a TLS handshake failure other than a certificate error")
+	flag.IntVar(&retryHTTP, "retries-http", 1, "Times to retry a fetch answered with a 5xx status, honoring Retry-After up to a minute")
+	flag.StringVar(&scopeFile, "scope-file", "", "File of in-scope hostnames, *.wildcards, IPs and CIDR ranges that replaces each target's own scope; hostnames are resolved to check the ranges")
+	flag.StringVar(&paramOut, "param-wordlist", "", "File to write the form field names and query parameter names found to, as a wordlist")
+	flag.BoolVar(&metaRobots, "respect-meta-robots", false, "Don't follow anything from pages whose robots meta tag or X-Robots-Tag header says nofollow; their links are still recorded")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics on at /metrics while crawling, e.g. :9090")
+	flag.DurationVar(&bodyTime, "max-body-read-time", 0, "Maximum time to spend reading a target's body once its headers arrived, keeping the links read until then (0 means no limit)")
+	flag.BoolVar(&normWWW, "normalize-www", false, "Treat a www. host and its apex domain as the same host for scope and deduplication")
+	flag.StringVar(&acceptLang, "accept-language", "", "Accept-Language header to send with page requests")
+	flag.StringVar(&probeLocs, "probe-locales", "", "Comma-separated locales to fetch each target in, e.g. en-US,de-DE,ja-JP, merging the links each one surfaces")
+	flag.BoolVar(&crawlIfrm, "crawl-iframes", false, "Also process in-scope <iframe> sources, one level deeper than the page embedding them")
 	flag.Parse()
 
-	if singleURL == "" && listFile == "" {
+	// Keep stdout clean for results when writing them there
+	if outputFile == "-" {
+		logOutput = os.Stderr
+	} else if compress && !strings.HasSuffix(outputFile, ".gz") {
+		outputFile += ".gz"
+	}
+	fmt.Fprintln(logOutput, `
+       __  ____      __
+ ___ ____ / /_/ __/__  ___/ /__
+ / _  / -_) __/ _// _  / _  (_-<
+ \_, /\__/\__/___/_//_/\_,_/___/
+ /___/   - Links Extractor      
+    `)
+
+	// -asn finds its own targets, and -ct-logs, -shodan and -expand-wildcards
+	// can start from the hosts of a -scope-file instead of -u or -l
+	scopeSeeded := scopeFile != "" && (ctLogs || useShodan || expandWild)
+	if singleURL == "" && listFile == "" && replayDir == "" && asnList == "" && !scopeSeeded {
+		if ctLogs || useShodan || expandWild {
+			fmt.Fprintln(logOutput, color.RedString("Invalid flags:"), "-ct-logs, -shodan and -expand-wildcards need targets from -u, -l or -scope-file")
+			os.Exit(1)
+		}
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
+	if scopeFrom != "original" && scopeFrom != "final" {
+		fmt.Fprintln(logOutput, color.RedString("Invalid -scope-origin value:"), scopeFrom, "(expected original or final)")
+		os.Exit(1)
+	}
+	if replayDir != "" && (dumpDir != "" || detectPush || expandWild || wwwVariants || ctLogs || useShodan || preCheck) {
+		fmt.Fprintln(logOutput, color.RedString("Invalid flags:"), "-replay-dir cannot be used with -dump-dir, -detect-h2-push, -expand-wildcards, -www-variants, -ct-logs, -shodan or -preflight-check, which need the network")
+		os.Exit(1)
+	}
+	if sortedOut && (countOut || sortByCount) {
+		fmt.Fprintln(logOutput, color.RedString("Invalid flags:"), "-output-on-the-fly-sorted cannot be used with -count-output or -sort-by-count, which need every URL's final count")
+		os.Exit(1)
+	}
+	// locales are the Accept-Language values each target is fetched with for -probe-locales
+	locales := parseLocales(probeLocs)
+	if probeLocs != "" && len(locales) == 0 {
+		fmt.Fprintln(logOutput, color.RedString("Invalid -probe-locales value:"), probeLocs)
+		os.Exit(1)
+	}
+	if retryDNS < 0 || retryConn < 0 || retryTLS < 0 || retryHTTP < 0 {
+		fmt.Fprintln(logOutput, color.RedString("Invalid retries:"), "-retries-dns, -retries-connect, -retries-tls and -retries-http cannot be negative")
+		os.Exit(1)
+	}
+	if useHTTP3 && socksProxy != "" {
+		fmt.Fprintln(logOutput, color.RedString("Invalid flags:"), "-http3 cannot be used with -socks5, which only carries TCP")
+		os.Exit(1)
+	}
+	if scanJS && jsWorkers < 1 {
+		fmt.Fprintln(logOutput, color.RedString("Invalid concurrency:"), "-js-concurrency must be at least 1")
+		os.Exit(1)
+	}
+	if concurrency < 1 || cHTTP < 0 || cHTTPS < 0 {
+		fmt.Fprintln(logOutput, color.RedString("Invalid concurrency:"), "-c must be at least 1 and -c-http/-c-https cannot be negative")
+		os.Exit(1)
+	}
+	if autoConc && (autoFloor < 1 || autoFloor > concurrency) {
+		fmt.Fprintln(logOutput, color.RedString("Invalid concurrency:"), "-auto-floor must be between 1 and -c")
+		os.Exit(1)
+	}
+	for _, spec := range extraAttr {
+		if err := addExtraAttr(spec); err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error parsing -attr:"), err)
+			os.Exit(1)
+		}
+	}
+	if burst < 1 {
+		fmt.Fprintln(logOutput, color.RedString("Invalid -burst value:"), burst, "(must be at least 1)")
+		os.Exit(1)
+	}
+	if maxHosts < 0 {
+		fmt.Fprintln(logOutput, color.RedString("Invalid -max-hosts value:"), maxHosts, "(cannot be negative)")
+		os.Exit(1)
+	}
+	if autoErrRate < 0 || autoErrRate > 1 {
+		fmt.Fprintln(logOutput, color.RedString("Invalid -auto-error-rate value:"), autoErrRate, "(expected a share between 0 and 1)")
+		os.Exit(1)
+	}
+
+	if pdfMode {
+		removeJunkExtension(".pdf")
+	}
+	if parseCSS {
+		removeJunkExtension(".css")
+	}
+
+	var scopeSelector cascadia.Matcher
+	if scopeSel != "" {
+		sel, err := cascadia.ParseGroup(scopeSel)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error parsing -scope-selector:"), err)
+			os.Exit(1)
+		}
+		scopeSelector = sel
+	}
+
+	var guards *crawlGuards
+	if len(crawlExcl) > 0 || len(depthCaps) > 0 || maxHosts > 0 {
+		guards = &crawlGuards{maxHosts: maxHosts}
+		for _, expr := range crawlExcl {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				fmt.Fprintln(logOutput, color.RedString("Error parsing -crawl-exclude:"), err)
+				os.Exit(1)
+			}
+			guards.exclude = append(guards.exclude, re)
+		}
+		for _, c := range depthCaps {
+			parsed, err := parseDepthCap(c)
+			if err != nil {
+				fmt.Fprintln(logOutput, color.RedString("Error parsing -depth-cap:"), err)
+				os.Exit(1)
+			}
+			guards.caps = append(guards.caps, parsed)
+		}
+	}
+
+	urlRewriter, err := parseRewriter(rewrites)
+	if err != nil {
+		fmt.Fprintln(logOutput, color.RedString("Error parsing -rewrite:"), err)
+		os.Exit(1)
+	}
+	outRewriter, err := parseRewriter(outRewrites)
+	if err != nil {
+		fmt.Fprintln(logOutput, color.RedString("Error parsing -rewrite-output:"), err)
+		os.Exit(1)
+	}
+
+	classes := classifier(defaultClassRules)
+	if classFile != "" {
+		classes, err = loadClassRules(classFile)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading -classify-rules:"), err)
+			os.Exit(1)
+		}
+	}
+
+	var maxOutSize int64
+	if maxOutStr != "" {
+		size, err := parseSize(maxOutStr)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error parsing -max-output-size:"), err)
+			os.Exit(1)
+		}
+		maxOutSize = size
+	}
+
+	matchCodes, err := parseStatusCodes(matchList)
+	if err != nil {
+		fmt.Fprintln(logOutput, color.RedString("Error parsing -match-codes:"), err)
+		os.Exit(1)
+	}
+	excludeCodes, err := parseStatusCodes(exclList)
+	if err != nil {
+		fmt.Fprintln(logOutput, color.RedString("Error parsing -exclude-codes:"), err)
+		os.Exit(1)
+	}
+
+	servers, err := parseDNSServers(dnsList)
+	if err != nil {
+		fmt.Fprintln(logOutput, color.RedString("Error parsing DNS servers:"), err)
+		os.Exit(1)
+	}
+	dnsServers = servers
+
+	// baseCtx is the parent of the contexts of every lookup and request. Ctrl+C
+	// or SIGTERM cancels it, which stops the workers so that what was found so
+	// far is still written out; a second one exits at once.
+	baseCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
 	var urlsToProcess []string
 
 	if singleURL != "" {
@@ -75,240 +517,3251 @@ func main() {
 	if listFile != "" {
 		urlsFromFile, err := readURLsFromFile(listFile)
 		if err != nil {
-			fmt.Println(color.RedString("Error reading URLs from file:"), err)
+			fmt.Fprintln(logOutput, color.RedString("Error reading URLs from file:"), err)
 			os.Exit(1)
 		}
 		urlsToProcess = append(urlsToProcess, urlsFromFile...)
 	}
 
-	allExtractedURLs := make(map[string]struct{})
-
-	userAgent := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/97.0.4692.99 Safari/537.36"
-	acceptHeader := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
-
-	// Create a custom HTTP client with the custom resolver and DNS timeout
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		DialContext: (&net.Dialer{
-			Timeout:   15 * time.Second,
-			KeepAlive: 15 * time.Second,
-			Resolver:  customResolver,
-		}).DialContext,
-	}
-	client := &http.Client{
-		Transport: tr,
-		Timeout:   30 * time.Second,
+	if singleURL == "" && listFile == "" && scopeSeeded {
+		entries, err := loadScopeList(scopeFile, nil)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading -scope-file:"), err)
+			os.Exit(1)
+		}
+		seeds := entries.seeds(expandWild)
+		urlsToProcess = append(urlsToProcess, seeds...)
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Starting from %d hosts of", len(seeds))), color.YellowString(scopeFile), color.CyanString("---"))
 	}
 
-	for _, targetURL := range urlsToProcess {
-		// Check and add scheme if missing
-		if !strings.HasPrefix(targetURL, "http://") && !strings.HasPrefix(targetURL, "https://") {
-			targetURL = "http://" + targetURL
+	var replay *replayTransport
+	if replayDir != "" {
+		replay, err = loadReplay(replayDir)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading -replay-dir:"), err)
+			os.Exit(1)
 		}
-
-		req, err := http.NewRequest("GET", targetURL, nil)
+		if len(urlsToProcess) == 0 {
+			urlsToProcess = replay.pages()
+		}
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Replaying %d saved responses from", len(replay.records))), color.YellowString(replayDir), "---")
+	}
+	// hints holds what earlier runs learned about hosts; applied is the part
+	// this run starts from, which is empty with -no-hints
+	hints := make(map[string]hostHint)
+	applied := make(map[string]hostHint)
+	if hintsOut != "" {
+		hints, err = loadHints(hintsOut, hintsMaxAge)
 		if err != nil {
-			fmt.Println(color.RedString("Error creating request for"), color.YellowString(targetURL), ":", err)
-			continue
+			fmt.Fprintln(logOutput, color.YellowString("Warning: Ignoring -hints file:"), err)
+			hints = make(map[string]hostHint)
 		}
-		req.Header.Set("User-Agent", userAgent)
-		if !noAccept {
-			req.Header.Set("Accept", acceptHeader)
+		if !noHints {
+			applied = hints
+			fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Loaded hints for %d hosts ---", len(hints))))
 		}
+	}
+	if dumpDir != "" {
+		if err := os.MkdirAll(dumpDir, 0755); err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error creating -dump-dir:"), err)
+			os.Exit(1)
+		}
+	}
 
-		resp, err := client.Do(req)
+	// Wildcard targets are replaced by the subdomains that could be confirmed
+	if expandWild {
+		words, err := loadSubdomainWords(subWords)
 		if err != nil {
-			// Check if the error is due to a TLS handshake failure or a DNS issue
-			if urlErr, ok := err.(*url.Error); ok {
-				if strings.Contains(urlErr.Error(), "x509: certificate") || strings.Contains(urlErr.Error(), "tls:") {
-					fmt.Println(color.YellowString("Warning: Skipping SSL error for"), color.YellowString(targetURL))
-					continue
-				} else if urlErr.Timeout() {
-					fmt.Println(color.YellowString("Warning: Timeout during connection for"), color.YellowString(targetURL))
-					continue
-				} else if strings.Contains(urlErr.Error(), "lookup") || strings.Contains(urlErr.Error(), "connect") {
-					fmt.Println(color.YellowString("Warning: DNS or connection error for"), color.YellowString(targetURL), "-", urlErr)
-					continue
+			fmt.Fprintln(logOutput, color.RedString("Error reading subdomain wordlist:"), err)
+			os.Exit(1)
+		}
+		var expanded []string
+		for _, target := range urlsToProcess {
+			scheme, domain, ok := parseWildcardTarget(target)
+			if !ok {
+				expanded = append(expanded, target)
+				continue
+			}
+			fmt.Fprintln(logOutput, color.CyanString("--- [INFO] Expanding wildcard"), color.YellowString(target), "---")
+			hosts, err := expandWildcard(customResolver, domain, words)
+			if err != nil {
+				fmt.Fprintln(logOutput, color.YellowString("Warning:"), err)
+			}
+			for _, host := range hosts {
+				if verbose {
+					fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Found subdomain:"), host)
 				}
+				expanded = append(expanded, scheme+host)
 			}
-			fmt.Println(color.RedString("Error fetching"), color.YellowString(targetURL), ":", err)
-			continue
+			fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Found %d hosts under %s ---", len(hosts), domain)))
 		}
-		defer resp.Body.Close()
+		urlsToProcess = expanded
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			fmt.Println(color.RedString("Error response for"), color.YellowString(targetURL), ":", resp.Status)
-			continue
+	var overrides domainOverrides
+	if overFile != "" {
+		overrides, err = loadOverrides(overFile)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading overrides file:"), err)
+			os.Exit(1)
 		}
+	}
 
-		fmt.Println(color.CyanString("--- [INFO] Processing"), color.YellowString(targetURL), "---")
-		links := extractLinks(resp.Body, targetURL)
+	var trackers trackerSet
+	if !noTrackers {
+		trackers, err = loadTrackers(trackFile)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading tracker list:"), err)
+			os.Exit(1)
+		}
+	}
 
-		targetHostname := getHostname(targetURL)
+	var blocked *blocklist
+	if blockFile != "" {
+		blocked, err = loadBlocklist(blockFile)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading blocklist file:"), err)
+			os.Exit(1)
+		}
+	}
 
-		for _, link := range links {
-			parsedLink, err := url.Parse(link)
-			if err != nil {
-				continue
-			}
+	var excluded *excludeList
+	if exclFile != "" {
+		excluded, err = loadExcludeList(exclFile)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading -exclude-file:"), err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Loaded %d exclusions from", excluded.size())), color.YellowString(exclFile), color.CyanString("---"))
+	}
+	// suppressed holds the findings matching -exclude-file, which are only counted
+	suppressed := make(map[string]struct{})
 
-			resolvedLink := ""
-			if !parsedLink.IsAbs() {
-				baseURL, err := url.Parse(targetURL)
-				if err != nil {
-					continue
-				}
-				resolvedLink = baseURL.ResolveReference(parsedLink).String()
-			} else {
-				resolvedLink = parsedLink.String()
+	// Naked and www. hosts often serve different content, so each gets the other added
+	if wwwVariants {
+		// resolves caches lookups, as lists often hold several URLs on the same host
+		resolves := make(map[string]bool)
+		resolvable := func(host string) bool {
+			if ok, done := resolves[host]; done {
+				return ok
 			}
+			ctx, cancel := context.WithTimeout(baseCtx, 10*time.Second)
+			defer cancel()
+			_, err := customResolver.LookupHost(ctx, host)
+			resolves[host] = err == nil
+			return err == nil
+		}
 
-			resolvedLinkHostname := getHostname(resolvedLink)
-
-			// In-scope check
-			if !strings.HasSuffix(resolvedLinkHostname, "."+targetHostname) && resolvedLinkHostname != targetHostname {
+		seen := make(map[string]struct{})
+		for _, u := range urlsToProcess {
+			seen[u] = struct{}{}
+		}
+		added := 0
+		for _, u := range urlsToProcess {
+			target, _ := normalizeTarget(u)
+			variant, ok := wwwVariant(target)
+			if !ok {
 				continue
 			}
-
-			// Skip if the link is a mailto, tel, or similar
-			if strings.HasPrefix(parsedLink.Scheme, "mail") || strings.HasPrefix(parsedLink.Scheme, "tel") {
+			if _, dup := seen[variant]; dup {
 				continue
 			}
+			seen[variant] = struct{}{}
 
-			// Junk file check
-			if isJunkFile(parsedLink.Path) {
-				continue
+			// Scope-check the variant as if it were a discovered link
+			full := variant
+			if !strings.Contains(full, "://") {
+				full = "http://" + full
 			}
-
-			if jsOnly && !strings.HasSuffix(parsedLink.Path, ".js") {
-				continue
-			} else if !jsOnly && strings.HasSuffix(parsedLink.Path, ".js") {
+			_, override := overrides.lookup(getHostname(full))
+			if blocked.blocks(full) || override.excluded(full) {
+				if verbose {
+					fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Out-of-scope www variant:"), variant)
+				}
 				continue
 			}
-
-			// Make sure the link isn't just the base URL itself
-			if resolvedLink == targetURL {
+			original := target
+			if !strings.Contains(original, "://") {
+				original = "http://" + original
+			}
+			if !resolvable(getHostname(original)) || !resolvable(getHostname(full)) {
+				if verbose {
+					fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Unresolvable www variant:"), variant)
+				}
 				continue
 			}
+			urlsToProcess = append(urlsToProcess, variant)
+			added++
+		}
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Added %d www variants ---", added)))
+	}
 
-			// Check for duplicates before storing
-			if _, loaded := allExtractedURLs[resolvedLink]; !loaded {
-				allExtractedURLs[resolvedLink] = struct{}{}
-				fmt.Println(color.GreenString("[EXTRACTED] " + resolvedLink))
+	if dryRun {
+		fmt.Fprintln(logOutput, color.CyanString("--- [DRY-RUN] Targets ---"))
+		for _, u := range urlsToProcess {
+			target, _ := normalizeTarget(u)
+			host := getHostname(target)
+			if !strings.Contains(target, "://") {
+				host = getHostname("http://" + target)
+			}
+			if pattern, _ := overrides.lookup(host); pattern != "" {
+				fmt.Fprintln(logOutput, target, color.BlueString("(overrides: "+pattern+")"))
+			} else {
+				fmt.Fprintln(logOutput, target)
 			}
 		}
+		if len(overrides) > 0 {
+			fmt.Fprintln(logOutput, color.CyanString("--- [DRY-RUN] Per-domain overrides ---"))
+			printOverrides(overrides)
+		}
+		return
 	}
 
-	var finalURLs []string
-	for u := range allExtractedURLs {
-		finalURLs = append(finalURLs, u)
+	var results *redisSink
+	if redisURL != "" {
+		results, err = newRedisSink(redisURL, redisKey)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error connecting to Redis:"), err)
+			os.Exit(1)
+		}
 	}
 
-	if len(finalURLs) > 0 {
-		err := writeURLsToFile(outputFile, finalURLs)
+	var producer *kafkaSink
+	// kafkaOnly is set when Kafka takes the place of the output file
+	kafkaOnly := false
+	if kafkaAddrs != "" {
+		producer, err = newKafkaSink(kafkaAddrs, kafkaTopic)
 		if err != nil {
-			fmt.Println(color.RedString("Error writing extracted URLs to file:"), err)
-		} else {
-			fmt.Println(color.MagentaString("--- [OUTPUT] Extracted URLs written to"), color.YellowString(outputFile), "---")
+			fmt.Fprintln(logOutput, color.RedString("Error connecting to Kafka:"), err)
+			os.Exit(1)
 		}
-	} else {
-		fmt.Println(color.YellowString("No URLs extracted. Either no links were found or the filters were too restrictive."))
+		kafkaOnly = true
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "o" {
+				kafkaOnly = false
+			}
+		})
 	}
-}
 
-// isJunkFile checks if a file path ends with a common media or junk file extension.
-func isJunkFile(path string) bool {
-	junkExtensions := []string{
-		".css", ".jpeg", ".jpg", ".png", ".gif", ".svg", ".ico", ".webp",
-		".mp4", ".mov", ".avi", ".webm", ".mkv",
-		".woff", ".woff2", ".ttf", ".eot", ".otf",
-		".pdf", ".docx", ".xlsx", ".pptx", ".zip", ".rar", ".7z",
-		".xml",
+	var indexer *esSink
+	if esAddrs != "" {
+		indexer, err = newESSink(esAddrs, esIndex)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error connecting to Elasticsearch:"), err)
+			os.Exit(1)
+		}
 	}
 
-	for _, ext := range junkExtensions {
-		if strings.HasSuffix(strings.ToLower(path), ext) {
-			return true
+	smallJSURLs := make(map[string]struct{})
+	longURLs := make(map[string]struct{})
+	fetchedPDFs := make(map[string]struct{})
+	fetchedCSS := make(map[string]struct{})
+	blockedURLs := make(map[string]struct{})
+	// sizesSeen holds the host, status and Content-Length of the responses
+	// extracted from, for -dedupe-by-response-size; sizeDupes lists the skipped targets
+	sizesSeen := make(map[string]struct{})
+	sizeDupes := make(map[string]struct{})
+	// slowBodies holds the targets whose body read was cut off by -max-body-read-time
+	slowBodies := make(map[string]struct{})
+	trackerURLs := make(map[string]struct{})
+	// commentHits holds the comment findings already reported, as kind and match
+	commentHits := make(map[string]struct{})
+	// blankLinks holds external links opened with target=_blank
+	blankLinks := make(map[string]struct{})
+	sanHosts := make(map[string]struct{})
+	// urlClasses holds the class of each extracted URL for -classify
+	urlClasses := make(map[string]string)
+	// spool collects the output lines for -output-on-the-fly-sorted as URLs are
+	// extracted
+	var spool *sortedSpool
+	if sortedOut {
+		spool, err = newSortedSpool()
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error creating the output spool:"), err)
+			os.Exit(1)
 		}
+		defer spool.Close()
 	}
-	return false
-}
-
-// extractLinks parses HTML from an io.Reader and returns a list of links.
-func extractLinks(body io.Reader, baseURL string) []string {
-	links := make([]string, 0)
-	z := html.NewTokenizer(body)
-
-	for {
-		tt := z.Next()
-		switch tt {
-		case html.ErrorToken:
-			if z.Err() == io.EOF {
-				return links
-			}
-			return links
-		case html.StartTagToken, html.SelfClosingTagToken:
-			token := z.Token()
-			if token.Data == "a" {
-				for _, attr := range token.Attr {
-					if attr.Key == "href" {
-						links = append(links, attr.Val)
-					}
-				}
-			} else if token.Data == "script" || token.Data == "link" {
-				for _, attr := range token.Attr {
-					if attr.Key == "src" || attr.Key == "href" {
-						links = append(links, attr.Val)
-					}
-				}
+	// allExtractedURLs holds every URL extracted. With the spool it only keeps
+	// their hashes, unless -state or -export-state need the URLs listed.
+	allExtractedURLs := newURLSet(spool != nil && stateFile == "" && exportOut == "")
+	// spoolURL adds the output line of an extracted URL to the spool; class is
+	// its class, or empty for URLs restored from -state
+	spoolURL := func(u, class string) {
+		if spool == nil {
+			return
+		}
+		line := outRewriter.rewrite(u)
+		if classify {
+			if class == "" {
+				class = classes.classify(u, false)
 			}
+			line = class + "\t" + line
 		}
+		spool.add(line)
 	}
-}
+	// linkSources maps each extracted URL to the pages (or PDFs and stylesheets) linking to it
+	linkSources := make(map[string]map[string]struct{})
+	// occurrences counts the pages each extracted URL was found on, for
+	// -count-output and -sort-by-count; links on every page are usually navigation
+	occurrences := make(map[string]int)
+	// formFields maps the form actions extracted to the names of their fields,
+	// and paramNames collects every field name for -param-wordlist
+	formFields := make(map[string][]string)
+	paramNames := make(map[string]struct{})
+	// urlLocales maps the extracted URLs that only some -probe-locales surfaced to those locales
+	urlLocales := make(map[string][]string)
+	var headerRecords []string
 
-// readURLsFromFile reads a list of URLs from a file.
-func readURLsFromFile(filename string) ([]string, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+	// prevHashes holds the body hashes recorded by the previous run with -hashes-out
+	var prevHashes map[string]pageHash
+	var hashRecords []string
+	if hashOut != "" {
+		hashes, err := loadPageHashes(hashOut)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading hashes file:"), err)
+			os.Exit(1)
+		}
+		prevHashes = hashes
 	}
-	defer file.Close()
 
-	var urls []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		urls = append(urls, strings.TrimSpace(scanner.Text()))
+	userAgent := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/97.0.4692.99 Safari/537.36"
+	acceptHeader := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+	// Create a custom HTTP client with the custom resolver and DNS timeout
+	dialer := &net.Dialer{
+		Timeout:   15 * time.Second,
+		KeepAlive: 15 * time.Second,
+		Resolver:  customResolver,
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	if sourceIP != "" || ifaceName != "" {
+		localIP, err := localAddress(sourceIP, ifaceName)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error choosing the source address:"), err)
+			os.Exit(1)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: localIP}
+		if useHTTP3 {
+			fmt.Fprintln(logOutput, color.YellowString("Warning: -source-ip and -interface don't apply to HTTP/3 connections"))
+		}
+	}
+	// IP literal targets never need the custom resolver, so they get a dialer without one
+	dialContext := ipLiteralDialContext(&net.Dialer{Timeout: dialer.Timeout, KeepAlive: dialer.KeepAlive, LocalAddr: dialer.LocalAddr}, dialer.DialContext)
+	if noPrivate {
+		dialContext = privateGuardDialContext(dialContext)
 	}
-	return urls, nil
-}
 
-// getHostname extracts the hostname from a URL.
-func getHostname(u string) string {
-	parsedURL, err := url.Parse(u)
-	if err != nil {
-		return ""
+	// When proxying, hostnames are passed to the proxy so DNS resolves on the far side
+	if socksProxy != "" {
+		if noPrivate {
+			fmt.Fprintln(logOutput, color.YellowString("Warning: -block-private cannot validate addresses resolved by the SOCKS5 proxy"))
+		}
+		dialContext, err = socks5DialContext(socksProxy, dialer)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error configuring SOCKS5 proxy:"), err)
+			os.Exit(1)
+		}
 	}
-	return parsedURL.Hostname()
-}
+
+	var hosts map[string][]string
+	if useHosts {
+		hosts, err = loadHostsFile(hostsFilePath)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading hosts file:"), err)
+			os.Exit(1)
+		}
+		dialContext = hostsDialContext(hosts, dialContext)
+	}
+
+	var scope *scopeList
+	if scopeFile != "" {
+		scope, err = loadScopeList(scopeFile, func(ctx context.Context, host string) ([]string, error) {
+			if ips, ok := hosts[host]; ok {
+				return ips, nil
+			}
+			return customResolver.LookupHost(ctx, host)
+		})
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading -scope-file:"), err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Loaded %d scope entries from", scope.size())), color.YellowString(scopeFile), color.CyanString("---"))
+	}
+	// linkInScope reports whether links on host are kept for a target on
+	// targetHost: the -scope-file decides when given, otherwise the target's
+	// host and its subdomains are in scope
+	linkInScope := func(host, targetHost string) bool {
+		if scope != nil {
+			return scope.allows(host) || normWWW && scope.allows(strings.TrimPrefix(host, "www."))
+		}
+		if normWWW {
+			host, targetHost = strings.TrimPrefix(host, "www."), strings.TrimPrefix(targetHost, "www.")
+		}
+		return inScope(host, targetHost)
+	}
+	// prepareScope looks up the hosts of refs, resolved against base, that
+	// the -scope-file networks need, so linkInScope doesn't wait on DNS with
+	// mu held; www. variants are included for -normalize-www
+	prepareScope := func(base string, refs []string) {
+		if scope == nil {
+			return
+		}
+		hosts := make([]string, 0, len(refs))
+		for _, ref := range refs {
+			u, err := resolveLink(base, ref)
+			if err != nil {
+				continue
+			}
+			host := getHostname(urlRewriter.rewrite(u))
+			hosts = append(hosts, host)
+			if normWWW {
+				apex := strings.TrimPrefix(host, "www.")
+				hosts = append(hosts, apex, "www."+apex)
+			}
+		}
+		scope.resolve(hosts)
+	}
+
+	tr := &http.Transport{
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: !verifyTLS},
+		DialContext:           dialContext,
+		TLSHandshakeTimeout:   tlsTimeout,
+		ResponseHeaderTimeout: hdrTimeout,
+	}
+	if maxIdle > 0 {
+		tr.MaxIdleConnsPerHost = maxIdle
+	} else if concurrency > http.DefaultMaxIdleConnsPerHost {
+		// Keep a connection per worker instead of redialing after every request
+		tr.MaxIdleConnsPerHost = concurrency
+	}
+
+	// mu guards the state shared by the workers; cond signals when targets are
+	// added to urlsToProcess or a worker finishes
+	var mu sync.Mutex
+	cond := sync.NewCond(&mu)
+
+	// downgrades collects redirect chains containing an https to http hop. It has
+	// its own lock since redirects are also followed while mu is held.
+	var (
+		downgrades   []string
+		downgradesMu sync.Mutex
+	)
+	// withHTTP3 puts an HTTP/3 transport in front of fallback for -http3
+	// h3Transports are the transports withHTTP3 made, whose QUIC failures go into -hints
+	var h3Transports []*http3Transport
+	withHTTP3 := func(fallback http.RoundTripper, insecureTLS bool) http.RoundTripper {
+		if !useHTTP3 {
+			return fallback
+		}
+		quicConfig := &quic.Config{}
+		if tlsTimeout > 0 {
+			quicConfig.HandshakeIdleTimeout = tlsTimeout
+		}
+		h3 := newHTTP3Transport(&http3.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecureTLS},
+			QUICConfig:      quicConfig,
+			Dial:            quicDial(hosts, customResolver, noPrivate),
+		}, fallback)
+		// A stale hint only costs the host HTTP/3, never the connection
+		for host, hint := range applied {
+			if hint.NoHTTP3 {
+				h3.skipQUIC(host)
+			}
+		}
+		h3Transports = append(h3Transports, h3)
+		return h3
+	}
+	transport := withHTTP3(tr, !verifyTLS)
+	if skipTLS != "" {
+		if !verifyTLS {
+			fmt.Fprintln(logOutput, color.YellowString("Warning: -skip-tls-hosts has no effect without -verify-tls"))
+		} else {
+			insecure := tr.Clone()
+			insecure.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			transport = &hostTLSTransport{verified: transport, insecure: withHTTP3(insecure, true), skip: parseHostList(skipTLS)}
+		}
+	}
+	if replay != nil {
+		transport = replay
+	} else if dumpDir != "" {
+		transport = &dumpTransport{next: transport, dir: dumpDir}
+	}
+	if traceReqs {
+		transport = &traceTransport{next: transport}
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   30 * time.Second,
+		CheckRedirect: redirectPolicy(maxRedir, func(chain string) {
+			downgradesMu.Lock()
+			downgrades = append(downgrades, chain)
+			downgradesMu.Unlock()
+		}),
+	}
+
+	if cookieJar != "" {
+		jar, loaded, err := loadCookieJar(cookieJar)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading cookie jar file:"), err)
+			os.Exit(1)
+		}
+		client.Jar = jar
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Loaded %d cookies from %s ---", loaded, cookieJar)))
+	}
+
+	// limiters pace the requests to each host with a per-domain rate limit
+	limiters := make(map[string]*rate.Limiter)
+
+	// schemeSlots caps concurrent requests per scheme, from -c-http and -c-https
+	schemeSlots := make(map[string]chan struct{})
+	if cHTTP > 0 {
+		schemeSlots["http"] = make(chan struct{}, cHTTP)
+	}
+	if cHTTPS > 0 {
+		schemeSlots["https"] = make(chan struct{}, cHTTPS)
+	}
+
+	var metrics *crawlMetrics
+	if metricsAddr != "" {
+		listener, err := net.Listen("tcp", metricsAddr)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error listening for -metrics-addr:"), err)
+			os.Exit(1)
+		}
+		metrics = newCrawlMetrics()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		go http.Serve(listener, mux)
+		fmt.Fprintln(logOutput, color.CyanString("--- [INFO] Serving metrics on"), color.YellowString("http://"+listener.Addr().String()+"/metrics"), color.CyanString("---"))
+	}
+
+	// fetchOnce sends a GET request for u with the configured headers, giving up when ctx is done
+	fetchOnce := func(ctx context.Context, u string) (*http.Response, error) {
+		host := getHostname(u)
+		if _, override := overrides.lookup(host); override != nil && override.RateLimit > 0 {
+			// Up to -burst requests go out at once, then the host's rate applies;
+			// concurrent workers queue up behind each other's reservations
+			mu.Lock()
+			limiter := limiters[host]
+			if limiter == nil {
+				limiter = rate.NewLimiter(rate.Limit(override.RateLimit), burst)
+				limiters[host] = limiter
+			}
+			mu.Unlock()
+			// Wait fails early when the slot lies beyond the -target-budget deadline
+			if err := limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		if slots := schemeSlots[strings.SplitN(u, "://", 2)[0]]; slots != nil {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", userAgent)
+		if !noAccept {
+			req.Header.Set("Accept", acceptHeader)
+		}
+		if language := languageFrom(ctx); language != "" {
+			req.Header.Set("Accept-Language", language)
+		} else if acceptLang != "" {
+			req.Header.Set("Accept-Language", acceptLang)
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		metrics.requestDone(time.Since(start))
+		return resp, err
+	}
+
+	retries := retryPolicy{dns: retryDNS, connect: retryConn, tls: retryTLS, http: retryHTTP}
+	// fetchPage is fetchOnce retried as often as the class of each failure allows
+	fetchPage := func(ctx context.Context, u string) (*http.Response, error) {
+		for attempt := 0; ; attempt++ {
+			resp, err := fetchOnce(ctx, u)
+			delay, retry := retryDelay(retries, err, resp, attempt)
+			if !retry || ctx.Err() != nil {
+				return resp, err
+			}
+			if verbose {
+				fmt.Fprintln(logOutput, color.WhiteString(fmt.Sprintf("[VERBOSE] Retrying after %s failure in %s:", classifyFetch(err, resp), delay)), u)
+			}
+			if resp != nil {
+				io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+				resp.Body.Close()
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	// targetProtos records the protocol each target was fetched over with -http3
+	targetProtos := make(map[string]string)
+	// schemeCounts records which scheme ultimately worked for schemeless targets
+	schemeCounts := make(map[string]int)
+
+	// hostSchemes records the scheme that worked for each host, from -smart-scheme
+	// fallbacks and from redirects that upgrade http to https
+	hostSchemes := make(map[string]string)
+	// hintedSchemes are the hostSchemes taken from -hints and not yet confirmed
+	// by this run; if one fails, the target is retried over the other scheme
+	hintedSchemes := make(map[string]string)
+	for host, hint := range applied {
+		if hint.Scheme != "" {
+			hostSchemes[host] = hint.Scheme
+			hintedSchemes[host] = hint.Scheme
+		}
+	}
+
+	// knownHosts and apexes are the target hosts and their apex domains, for -ct-logs and -shodan
+	knownHosts := make(map[string]struct{})
+	var apexes []string
+	if ctLogs || useShodan {
+		seenApex := make(map[string]struct{})
+		for _, u := range urlsToProcess {
+			target, _ := normalizeTarget(u)
+			if !strings.Contains(target, "://") {
+				target = "http://" + target
+			}
+			host := getHostname(target)
+			knownHosts[host] = struct{}{}
+			if apex := apexDomain(host); apex != "" {
+				if _, ok := seenApex[apex]; !ok {
+					seenApex[apex] = struct{}{}
+					apexes = append(apexes, apex)
+				}
+			}
+		}
+	}
+
+	// Certificate Transparency adds https targets for subdomains of every apex domain
+	if ctLogs {
+		for _, apex := range apexes {
+			hosts, err := ctSubdomains(baseCtx, client, apex, userAgent)
+			if err != nil {
+				fmt.Fprintln(logOutput, color.YellowString("Warning: Could not query Certificate Transparency logs for"), color.YellowString(apex), "-", err)
+				continue
+			}
+			added := 0
+			for _, host := range hosts {
+				if _, ok := knownHosts[host]; !ok {
+					knownHosts[host] = struct{}{}
+					urlsToProcess = append(urlsToProcess, "https://"+host+"/")
+					added++
+				}
+			}
+			fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Added %d subdomains of %s from Certificate Transparency logs ---", added, apex)))
+		}
+	}
+
+	// Shodan adds the services it has indexed on hosts under every apex domain
+	if useShodan {
+		if shodanKey == "" {
+			fmt.Fprintln(logOutput, color.RedString("Error:"), "-shodan needs an API key from -shodan-key or $SHODAN_API_KEY")
+			os.Exit(1)
+		}
+		for _, apex := range apexes {
+			targets, err := shodanTargets(baseCtx, client, apex, shodanKey, userAgent)
+			if err != nil {
+				fmt.Fprintln(logOutput, color.YellowString("Warning: Could not search Shodan for"), color.YellowString(apex), "-", err)
+				continue
+			}
+			urlsToProcess = append(urlsToProcess, targets...)
+			fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Added %d services under %s from Shodan ---", len(targets), apex)))
+		}
+	}
+
+	// Every address announced by an ASN becomes a target, by hostname where it has a PTR record
+	if asnList != "" {
+		for _, item := range strings.Split(asnList, ",") {
+			asn, err := normalizeASN(item)
+			if err != nil {
+				fmt.Fprintln(logOutput, color.RedString("Error parsing -asn:"), err)
+				os.Exit(1)
+			}
+			prefixes, err := asnPrefixes(baseCtx, client, asn, userAgent)
+			if err != nil {
+				fmt.Fprintln(logOutput, color.YellowString("Warning: Could not look up the prefixes announced by"), color.YellowString(asn), "-", err)
+				continue
+			}
+			var ips []net.IP
+			for _, prefix := range prefixes {
+				addrs, err := prefixAddresses(prefix, asnMaxIPs-len(ips))
+				if err != nil {
+					if verbose {
+						fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Skipping prefix:"), err)
+					}
+					continue
+				}
+				ips = append(ips, addrs...)
+				if len(ips) >= asnMaxIPs {
+					fmt.Fprintln(logOutput, color.YellowString(fmt.Sprintf("Warning: %s announces more than %d addresses, raise -asn-max-ips to scan them all", asn, asnMaxIPs)))
+					break
+				}
+			}
+			fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Resolving %d addresses from %d prefixes of %s ---", len(ips), len(prefixes), asn)))
+			targets := reverseTargets(customResolver, ips)
+			urlsToProcess = append(urlsToProcess, targets...)
+			fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Added %d targets from %s ---", len(targets), asn)))
+		}
+	}
+
+	// prior holds the URLs found by earlier runs, from -known and a resumed -state;
+	// with any, findings are printed as [NEW] or, with -show-known, dimmed
+	var prior *priorRuns
+	if knownFile != "" {
+		lines := make(map[string]struct{})
+		if err := readExistingLines(knownFile, lines); err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading -known file:"), err)
+			os.Exit(1)
+		}
+		prior = newPriorRuns()
+		for line := range lines {
+			prior.addOutputLine(line)
+		}
+	}
+
+	// A saved state replaces the targets with its frontier; targets it hasn't seen are added after it
+	var resumed *crawlState
+	if stateFile != "" {
+		resumed, err = loadState(stateFile)
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading state file:"), err)
+			os.Exit(1)
+		}
+	}
+	if resumed != nil {
+		seen := make(map[string]struct{})
+		for _, u := range resumed.Done {
+			seen[u] = struct{}{}
+		}
+		for _, u := range resumed.Frontier {
+			seen[u] = struct{}{}
+		}
+		frontier := resumed.Frontier
+		for _, u := range urlsToProcess {
+			if _, ok := seen[u]; !ok {
+				seen[u] = struct{}{}
+				frontier = append(frontier, u)
+			}
+		}
+		urlsToProcess = frontier
+		if prior == nil {
+			prior = newPriorRuns()
+		}
+		for _, u := range resumed.Extracted {
+			if excluded.matches(u) {
+				suppressed[u] = struct{}{}
+				continue
+			}
+			allExtractedURLs.add(u)
+			prior.add(u)
+			spoolURL(u, "")
+		}
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Resuming from %s: %d targets done, %d to go ---", stateFile, len(resumed.Done), len(urlsToProcess))))
+	}
+
+	if preCheck && len(urlsToProcess) > 0 {
+		// Redirects aren't followed: any answer at all shows the target is up
+		probe := *client
+		probe.Timeout = preTimeout
+		probe.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		reachable := make([]bool, len(urlsToProcess))
+		var next int64 = -1
+		var probeWG sync.WaitGroup
+		for w := 0; w < concurrency; w++ {
+			probeWG.Add(1)
+			go func() {
+				defer probeWG.Done()
+				for {
+					i := int(atomic.AddInt64(&next, 1))
+					if i >= len(urlsToProcess) {
+						return
+					}
+					target, _ := normalizeTarget(urlsToProcess[i])
+					schemeless := !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://")
+					first, second := "http://", "https://"
+					if smartSch {
+						first, second = second, first
+					}
+					if !schemeless {
+						first, second = "", ""
+					}
+					ok, err := preflight(baseCtx, &probe, first+target, userAgent)
+					// The crawl tries the other scheme for schemeless targets too
+					if !ok && schemeless {
+						ok, err = preflight(baseCtx, &probe, second+target, userAgent)
+					}
+					reachable[i] = ok
+					if !ok {
+						fmt.Fprintln(logOutput, color.YellowString("Warning: Dropping unreachable target"), color.YellowString(urlsToProcess[i]), "-", err)
+					}
+				}
+			}()
+		}
+		probeWG.Wait()
+
+		kept := urlsToProcess[:0]
+		for i, u := range urlsToProcess {
+			if reachable[i] {
+				kept = append(kept, u)
+			}
+		}
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] Preflight: %d of %d targets reachable ---", len(kept), len(urlsToProcess))))
+		urlsToProcess = kept
+	}
+
+	// depths records the crawl depth of targets queued while running; targets
+	// from the command line are at depth 0
+	depths := make(map[string]int)
+
+	// queued tracks every URL added to urlsToProcess so discovered pages are only enqueued once
+	queued := make(map[string]struct{})
+	for _, u := range urlsToProcess {
+		queued[u] = struct{}{}
+		// The targets' own hosts count towards -max-hosts
+		target, _ := normalizeTarget(u)
+		if !strings.Contains(target, "://") {
+			target = "http://" + target
+		}
+		guards.addHost(getHostname(target))
+	}
+	if resumed != nil {
+		for _, u := range resumed.Queued {
+			queued[u] = struct{}{}
+		}
+		for u, depth := range resumed.Depths {
+			depths[u] = depth
+		}
+	}
+
+	// wwwTwin returns the www. or apex form of u that was already found or
+	// queued, so that -normalize-www keeps only the first form; mu must be held
+	wwwTwin := func(u string) string {
+		if !normWWW {
+			return u
+		}
+		if twin, ok := wwwVariant(u); ok {
+			if allExtractedURLs.has(twin) {
+				return twin
+			}
+			if _, found := queued[twin]; found {
+				return twin
+			}
+		}
+		return u
+	}
+
+	// exportTargets and exportURLs collect the fetched targets and the metadata
+	// of extracted URLs for -export-state
+	exportTargets := make(map[string]exportedTarget)
+	exportURLs := make(map[string]exportedURL)
+	exportExternal := 0
+
+	// record stores a newly extracted URL and reports it to the console and any
+	// streaming outputs. source is where it was found; mu must be held.
+	record := func(u, source, target, tag string, external bool) {
+		if excluded.matches(u) {
+			suppressed[u] = struct{}{}
+			return
+		}
+		allExtractedURLs.add(u)
+		metrics.urlExtracted()
+		// The structured outputs always carry the class; -classify adds it to the text output
+		class := classes.classify(u, external)
+		// The spool takes the class with the line, so it needn't be kept
+		if classify && spool == nil {
+			urlClasses[u] = class
+		}
+		spoolURL(u, class)
+		if exportOut != "" {
+			exportURLs[u] = exportedURL{
+				urlResult: urlResult{URL: u, Source: source, Target: target, Tag: tag, Class: class, Params: formFields[u], Locales: urlLocales[u], Time: time.Now()},
+				Depth:     exportTargets[target].Depth + 1,
+			}
+			if external {
+				exportExternal++
+			}
+		}
+		results.push(u)
+		if producer != nil || indexer != nil {
+			result := urlResult{URL: u, Source: source, Target: target, Tag: tag, Class: class, Params: formFields[u], Locales: urlLocales[u], Time: time.Now()}
+			producer.produce(result)
+			indexer.index(result)
+		}
+		label := color.GreenString("[EXTRACTED] " + u)
+		if prior != nil {
+			if prior.found(u, target) {
+				if !showKnown {
+					return
+				}
+				label = color.HiBlackString("[KNOWN] " + u)
+			} else {
+				label = color.HiGreenString("[NEW] " + u)
+			}
+		}
+		if tag != "" {
+			fmt.Fprintln(logOutput, label, color.BlueString("("+tag+")"))
+		} else {
+			fmt.Fprintln(logOutput, label)
+		}
+	}
+
+	// recall reports a URL that is already stored, as restored from -state, the
+	// first time this run finds it, as record would; mu must be held.
+	recall := func(u, target, tag string) {
+		if prior == nil || !prior.refound(u, target) {
+			return
+		}
+		if showKnown {
+			if tag != "" {
+				fmt.Fprintln(logOutput, color.HiBlackString("[KNOWN] "+u), color.BlueString("("+tag+")"))
+			} else {
+				fmt.Fprintln(logOutput, color.HiBlackString("[KNOWN] "+u))
+			}
+		}
+	}
+
+	// linkSource adds source to the pages linking to u for -link-graph and
+	// counts it once towards u's occurrences; mu must be held.
+	linkSource := func(u, source string) {
+		if graphOut == "" && !countOut && !sortByCount {
+			return
+		}
+		if _, ok := suppressed[u]; ok {
+			return
+		}
+		if linkSources[u] == nil {
+			linkSources[u] = make(map[string]struct{})
+		}
+		if _, seen := linkSources[u][source]; !seen {
+			linkSources[u][source] = struct{}{}
+			occurrences[u]++
+		}
+	}
+
+	// scripts queues in-scope scripts for the -scan-js workers, which scan them
+	// while pages are still being crawled; scannedJS keeps each to one scan
+	scripts := newJSQueue()
+	scannedJS := make(map[string]struct{})
+
+	// processTarget fetches a single target and records the links extracted from it.
+	// Shared state is guarded by mu, which isn't held while fetching the page.
+	// It reports whether the target failed, for -auto-concurrency.
+	processTarget := func(rawTarget string) (failed bool) {
+		// Accept request lines, host:port pairs and raw IPv6 addresses as targets
+		targetURL, note := normalizeTarget(rawTarget)
+		if verbose && note != "" {
+			fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] "+note+":"), rawTarget, "->", targetURL)
+		}
+
+		// Check and add scheme if missing
+		mu.Lock()
+		schemeless := !strings.HasPrefix(targetURL, "http://") && !strings.HasPrefix(targetURL, "https://")
+		// guessed is also set for host:port targets, whose scheme normalizeTarget
+		// picked by port convention, so a refused http attempt falls back to https
+		guessed := schemeless || !strings.Contains(rawTarget, "://")
+		hinted := ""
+		if schemeless {
+			hinted = hintedSchemes[getHostname("http://"+targetURL)]
+			scheme := "http://"
+			if smartSch {
+				scheme = "https://"
+			}
+			if known, ok := hostSchemes[getHostname("http://"+targetURL)]; ok {
+				scheme = known
+			}
+			targetURL = scheme + targetURL
+		}
+		queued[targetURL] = struct{}{}
+		// depth is how many documents were followed to reach this target
+		depth := depths[rawTarget]
+		mu.Unlock()
+
+		// ctx bounds the fetches, retries and body read for this target with -target-budget
+		ctx := baseCtx
+		if tgtBudget > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tgtBudget)
+			defer cancel()
+		}
+		if len(locales) > 0 {
+			ctx = withLanguage(ctx, locales[0])
+		}
+
+		triedHTTPS := strings.HasPrefix(targetURL, "https://")
+		resp, err := fetchPage(ctx, targetURL)
+		if err != nil && smartSch && schemeless && triedHTTPS && isTLSOrTimeout(err) && ctx.Err() == nil {
+			fmt.Fprintln(logOutput, color.YellowString("Warning: https failed for"), color.YellowString(targetURL), "- retrying over http")
+			targetURL = "http://" + strings.TrimPrefix(targetURL, "https://")
+			mu.Lock()
+			queued[targetURL] = struct{}{}
+			mu.Unlock()
+			resp, err = fetchPage(ctx, targetURL)
+		}
+		// Hosts that force TLS often refuse or reset plain http, so give https one try
+		if err != nil && guessed && !triedHTTPS && isRefusedOrReset(err) && ctx.Err() == nil {
+			fmt.Fprintln(logOutput, color.YellowString("Warning: http refused for"), color.YellowString(targetURL), "- retrying over https")
+			targetURL = "https://" + strings.TrimPrefix(targetURL, "http://")
+			mu.Lock()
+			queued[targetURL] = struct{}{}
+			mu.Unlock()
+			resp, err = fetchPage(ctx, targetURL)
+		}
+		// A scheme from -hints may be out of date, so the other one gets a try
+		if err != nil && hinted != "" && strings.HasPrefix(targetURL, hinted) && ctx.Err() == nil {
+			other := "https://"
+			if hinted == "https://" {
+				other = "http://"
+			}
+			fmt.Fprintln(logOutput, color.YellowString("Warning: Hinted scheme failed for"), color.YellowString(targetURL), "- retrying over", strings.TrimSuffix(other, "://"))
+			targetURL = other + strings.TrimPrefix(targetURL, hinted)
+			mu.Lock()
+			delete(hostSchemes, getHostname(targetURL))
+			delete(hintedSchemes, getHostname(targetURL))
+			queued[targetURL] = struct{}{}
+			mu.Unlock()
+			resp, err = fetchPage(ctx, targetURL)
+		}
+		if err == nil && guessed {
+			// Remember the scheme that worked for later targets on the same host;
+			// a host:port pair's scheme only holds for that port
+			scheme := strings.SplitN(targetURL, "//", 2)[0] + "//"
+			mu.Lock()
+			if schemeless {
+				delete(hintedSchemes, getHostname(targetURL))
+				hostSchemes[getHostname(targetURL)] = scheme
+			}
+			schemeCounts[strings.TrimSuffix(scheme, "://")]++
+			mu.Unlock()
+		}
+		if exportOut != "" {
+			info := exportedTarget{URL: targetURL, Depth: depth, Time: time.Now()}
+			if err != nil {
+				info.Error = err.Error()
+			} else {
+				info.Status, info.ContentType = resp.StatusCode, resp.Header.Get("Content-Type")
+			}
+			mu.Lock()
+			exportTargets[targetURL] = info
+			mu.Unlock()
+		}
+		if err != nil {
+			// Requests cut short by an interrupt say nothing about the target
+			if baseCtx.Err() != nil {
+				return
+			}
+			failed = true
+			metrics.fetchFailed(err, nil)
+			if errors.Is(err, errRedirectLoop) {
+				fmt.Fprintln(logOutput, color.YellowString("Warning: Redirect loop for"), color.YellowString(targetURL), "-", err)
+				return
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				fmt.Fprintln(logOutput, color.YellowString(fmt.Sprintf("Warning: Target budget of %s used up for", tgtBudget)), color.YellowString(targetURL))
+				return
+			}
+			// Check if the error is due to a TLS handshake failure or a DNS issue
+			if urlErr, ok := err.(*url.Error); ok {
+				if isTLSError(urlErr) {
+					fmt.Fprintln(logOutput, color.YellowString("Warning: Skipping SSL error for"), color.YellowString(targetURL))
+					return
+				} else if urlErr.Timeout() {
+					fmt.Fprintln(logOutput, color.YellowString("Warning: Timeout during connection for"), color.YellowString(targetURL))
+					return
+				} else if strings.Contains(urlErr.Error(), "lookup") || strings.Contains(urlErr.Error(), "connect") {
+					fmt.Fprintln(logOutput, color.YellowString("Warning: DNS or connection error for"), color.YellowString(targetURL), "-", urlErr)
+					return
+				}
+			}
+			fmt.Fprintln(logOutput, color.RedString("Error fetching"), color.YellowString(targetURL), ":", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if useHTTP3 {
+			mu.Lock()
+			targetProtos[targetURL] = resp.Proto
+			mu.Unlock()
+			if verbose {
+				fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Fetched over "+resp.Proto+":"), targetURL)
+			}
+		}
+
+		var headerRec *headerRecord
+		if headersOut != "" {
+			record := newHeaderRecord(targetURL, resp)
+			headerRec = &record
+			// Stored on return, so pages that get parsed include their title and snippet
+			defer func() {
+				if data, err := json.Marshal(headerRec); err == nil {
+					mu.Lock()
+					headerRecords = append(headerRecords, string(data))
+					mu.Unlock()
+				}
+			}()
+		}
+
+		if location := resp.Header.Get("Location"); maxRedir <= 0 && location != "" {
+			fmt.Fprintln(logOutput, color.YellowString("Warning: Not following redirect for"), color.YellowString(targetURL), "->", location)
+			return
+		}
+
+		// Throttling and server errors suggest the hosts are being pushed too hard
+		failed = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if failed {
+			metrics.fetchFailed(nil, resp)
+		}
+		if excludeCodes[resp.StatusCode] || !matchCodes[resp.StatusCode] {
+			fmt.Fprintln(logOutput, color.RedString("Error response for"), color.YellowString(targetURL), ":", resp.Status)
+			return
+		}
+
+		// Paginated and parameterized endpoints often answer with the same boilerplate,
+		// which is only spotted by its length; without one the response is kept
+		if dedupeSize && resp.ContentLength >= 0 {
+			key := fmt.Sprintf("%s\x00%d\x00%d", resp.Request.URL.Host, resp.StatusCode, resp.ContentLength)
+			mu.Lock()
+			_, dupe := sizesSeen[key]
+			if dupe {
+				sizeDupes[targetURL] = struct{}{}
+			} else {
+				sizesSeen[key] = struct{}{}
+			}
+			mu.Unlock()
+			if dupe {
+				if verbose {
+					fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Same status and length as an earlier response:"), targetURL, fmt.Sprintf("(%d, %d bytes)", resp.StatusCode, resp.ContentLength))
+				}
+				return
+			}
+		}
+
+		fmt.Fprintln(logOutput, color.CyanString("--- [INFO] Processing"), color.YellowString(targetURL), "---")
+
+		// Relative links are resolved against the final URL after any redirects
+		finalURL := resp.Request.URL.String()
+		if finalURL != targetURL {
+			fmt.Fprintln(logOutput, color.CyanString("--- [INFO] Redirected to"), color.YellowString(finalURL), "---")
+		}
+
+		// Remember HTTPS upgrades so later schemeless targets on the host go straight to https
+		if resp.Request.URL.Scheme == "https" && strings.HasPrefix(targetURL, "http://") && hostKey(resp.Request.URL.Hostname()) == getHostname(targetURL) {
+			mu.Lock()
+			hostSchemes[getHostname(targetURL)] = "https://"
+			mu.Unlock()
+			if verbose {
+				fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Upgraded to https:"), targetURL, "->", finalURL)
+			}
+		}
+		body := io.LimitReader(resp.Body, maxBody)
+		if bodyTime > 0 {
+			slow := newSlowBodyReader(resp.Body, bodyTime)
+			defer slow.stop()
+			body = io.LimitReader(slow, maxBody)
+		}
+		if metrics != nil {
+			counted := &countingReader{r: body}
+			body = counted
+			defer func() { metrics.bodyRead(counted.n) }()
+		}
+		var raw bytes.Buffer
+		if hashOut != "" {
+			body = io.TeeReader(body, &raw)
+		}
+		// extract parses a body with the parser the flags ask for
+		extract := func(body io.Reader, base string) page {
+			if scopeSelector != nil {
+				return extractScopedPage(body, base, scopeSelector)
+			} else if !strictParse {
+				return extractParsedPage(body, base)
+			}
+			return extractPage(body, base)
+		}
+		// pageLinks returns the links of a page, leaving out those in the head with -body-only
+		pageLinks := func(pg page) []string {
+			if !bodyOnly || len(pg.headLinks) == 0 {
+				return pg.links
+			}
+			links := make([]string, 0, len(pg.links))
+			for _, link := range pg.links {
+				if !pg.headLinks[link] {
+					links = append(links, link)
+				}
+			}
+			return links
+		}
+		pg := extract(body, finalURL)
+		links := pageLinks(pg)
+		if headerRec != nil {
+			headerRec.Title = pg.title
+			headerRec.Snippet = pg.snippet
+		}
+		if pg.err != nil {
+			if errors.Is(pg.err, errSlowBody) {
+				failed = true
+				metrics.fetchFailed(pg.err, nil)
+				mu.Lock()
+				slowBodies[targetURL] = struct{}{}
+				mu.Unlock()
+				fmt.Fprintln(logOutput, color.YellowString("Warning: Slow body for"), color.YellowString(targetURL), fmt.Sprintf("- read cut off after %s, keeping %d links extracted before then", bodyTime, len(links)))
+			} else if errors.Is(pg.err, io.ErrUnexpectedEOF) || errors.Is(pg.err, gzip.ErrChecksum) {
+				fmt.Fprintln(logOutput, color.YellowString("Warning: Truncated response body for"), color.YellowString(targetURL), fmt.Sprintf("- keeping %d links extracted before the error", len(links)))
+			} else {
+				fmt.Fprintln(logOutput, color.YellowString("Warning: Error reading response body for"), color.YellowString(targetURL), "-", pg.err, fmt.Sprintf("- keeping %d links extracted before the error", len(links)))
+			}
+		}
+
+		// Geo-aware sites may show other links to other locales. pageLocales maps
+		// the absolute URL of each link to the locales it was found in, and the
+		// links only other locales had are added to links, tagged with the first
+		var pageLocales map[string][]string
+		localeTags := make(map[string]string)
+		if len(locales) > 1 {
+			pageLocales = make(map[string][]string)
+			for _, link := range links {
+				if abs, err := resolveLink(finalURL, link); err == nil {
+					pageLocales[abs] = appendUnique(pageLocales[abs], locales[0])
+				}
+			}
+			for _, locale := range locales[1:] {
+				localeResp, err := fetchPage(withLanguage(ctx, locale), targetURL)
+				if err != nil {
+					fmt.Fprintln(logOutput, color.YellowString("Warning: Could not fetch"), color.YellowString(targetURL), "for locale", locale, "-", err)
+					continue
+				}
+				if excludeCodes[localeResp.StatusCode] || !matchCodes[localeResp.StatusCode] {
+					localeResp.Body.Close()
+					continue
+				}
+				base := localeResp.Request.URL.String()
+				localePage := extract(io.LimitReader(localeResp.Body, maxBody), base)
+				localeResp.Body.Close()
+				for _, link := range pageLinks(localePage) {
+					abs, err := resolveLink(base, link)
+					if err != nil {
+						continue
+					}
+					if _, seen := pageLocales[abs]; !seen {
+						links = append(links, abs)
+						localeTags[abs] = "locale " + locale
+					}
+					pageLocales[abs] = appendUnique(pageLocales[abs], locale)
+				}
+			}
+		}
+
+		// Pushed resources never appear in the HTML, and the client above can't receive them
+		var pushed []string
+		if detectPush && resp.Request.URL.Scheme == "https" {
+			insecure := !verifyTLS || skipTLS != "" && parseHostList(skipTLS)[hostKey(resp.Request.URL.Hostname())]
+			pushed, err = fetchH2Pushes(ctx, dialContext, insecure, finalURL, userAgent)
+			if err != nil {
+				fmt.Fprintln(logOutput, color.YellowString("Warning: Could not check HTTP/2 push for"), color.YellowString(finalURL), "-", err)
+			}
+		}
+
+		prepareScope(finalURL, append(append(append([]string{}, links...), pushed...), pg.canonical))
+
+		// Everything from here on updates the shared results
+		mu.Lock()
+		defer mu.Unlock()
+
+		// A partial body would look like a change, so only complete bodies are hashed
+		if hashOut != "" && pg.err == nil {
+			record := newPageHash(targetURL, decodeBody(raw.Bytes(), resp.Header.Get("Content-Type")))
+			if data, err := json.Marshal(record); err == nil {
+				hashRecords = append(hashRecords, string(data))
+			}
+			if prev, ok := prevHashes[targetURL]; ok && prev.SHA256 != record.SHA256 {
+				oldHash, _ := parseSimhash(prev.Simhash)
+				newHash, _ := parseSimhash(record.Simhash)
+				if distance := hammingDistance(oldHash, newHash); distance > changeDist {
+					fmt.Fprintln(logOutput, color.CyanString("--- [CHANGED]"), color.YellowString(targetURL), fmt.Sprintf("(simhash distance %d) ---", distance))
+				} else if verbose {
+					fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Body changed slightly:"), targetURL, fmt.Sprintf("(simhash distance %d)", distance))
+				}
+			}
+		}
+
+		// Certificates often name other vhosts and internal hosts of the same organisation
+		if certHosts && resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+			for _, name := range resp.TLS.PeerCertificates[0].DNSNames {
+				name = strings.ToLower(name)
+				if _, seen := sanHosts[name]; !seen {
+					sanHosts[name] = struct{}{}
+					fmt.Fprintln(logOutput, color.GreenString("[CERT-SAN] "+name), color.BlueString("("+getHostname(finalURL)+")"))
+				}
+			}
+		}
+
+		if commentScan {
+			for _, comment := range pg.comments {
+				for _, f := range scanComment(comment) {
+					// Templates repeat the same comment on every page, so each match is reported once
+					if _, seen := commentHits[f.kind+"\x00"+f.match]; seen {
+						continue
+					}
+					commentHits[f.kind+"\x00"+f.match] = struct{}{}
+					fmt.Fprintln(logOutput, color.RedString("[COMMENT-"+strings.ToUpper(f.kind)+"] "+f.match), color.BlueString("("+finalURL+")"), "-", f.context)
+				}
+			}
+		}
+
+		// linkTags records where links that didn't come from the page itself were found
+		linkTags := make(map[string]string)
+
+		targetHostname := getHostname(targetURL)
+		if scopeFrom == "final" {
+			targetHostname = getHostname(finalURL)
+		}
+
+		// noFollow keeps the page's links from being followed with -respect-meta-robots
+		noFollow := false
+		if metaRobots {
+			noFollow = pg.noFollow || xRobotsNoFollow(resp.Header.Values("X-Robots-Tag"))
+			if noFollow && verbose {
+				fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Robots nofollow, links won't be followed:"), finalURL)
+			}
+		}
+
+		// follow queues a discovered page as a target at the given depth
+		follow := func(u, kind string, depth int) {
+			if _, seen := queued[u]; seen || noFollow {
+				return
+			}
+			if !guards.allows(u, depth) {
+				if verbose {
+					fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Not following "+kind+" URL:"), u)
+				}
+				return
+			}
+			queued[u] = struct{}{}
+			depths[u] = depth
+			urlsToProcess = append(urlsToProcess, u)
+			cond.Broadcast()
+			fmt.Fprintln(logOutput, color.CyanString("--- [INFO] Queued "+kind+" URL"), color.YellowString(u), "---")
+		}
+
+		if canonical && pg.canonical != "" {
+			if canonicalURL, err := resolveLink(finalURL, pg.canonical); err == nil {
+				canonicalURL = wwwTwin(urlRewriter.rewrite(canonicalURL))
+				if linkInScope(getHostname(canonicalURL), targetHostname) {
+					follow(canonicalURL, "canonical", depth+1)
+				}
+			}
+		}
+
+		for _, content := range pg.metaCards {
+			if _, tagged := linkTags[content]; !tagged {
+				linkTags[content] = "meta-card"
+			}
+		}
+		for _, u := range pg.configURLs {
+			if _, tagged := linkTags[u]; !tagged {
+				linkTags[u] = "config"
+			}
+		}
+		for _, u := range pushed {
+			fmt.Fprintln(logOutput, color.GreenString("[H2-PUSH] "+u), color.BlueString("("+finalURL+")"))
+			if _, tagged := linkTags[u]; !tagged {
+				linkTags[u] = "h2-push"
+				links = append(links, u)
+			}
+		}
+		for value, source := range pg.attrLinks {
+			if _, tagged := linkTags[value]; !tagged {
+				linkTags[value] = "attr " + source
+			}
+		}
+		for u, tag := range localeTags {
+			if _, tagged := linkTags[u]; !tagged {
+				linkTags[u] = tag
+			}
+		}
+		for u := range pg.srcdocLinks {
+			if _, tagged := linkTags[u]; !tagged {
+				linkTags[u] = "srcdoc"
+			}
+		}
+		for action, fields := range pg.forms {
+			if _, tagged := linkTags[action]; !tagged && action != "" {
+				linkTags[action] = "form"
+			}
+			// The fields of forms posting to excluded URLs are left out with them
+			if resolved, err := resolveLink(finalURL, action); paramOut != "" && (err != nil || !excluded.matches(resolved)) {
+				for _, name := range fields {
+					paramNames[name] = struct{}{}
+				}
+			}
+		}
+		for href, filename := range pg.downloads {
+			if _, tagged := linkTags[href]; !tagged {
+				linkTags[href] = strings.TrimSpace("download " + filename)
+			}
+		}
+
+		// Frames are part of the page itself, so same-host frames are always
+		// followed and stay at the page's depth
+		for _, src := range pg.frames {
+			if _, tagged := linkTags[src]; !tagged {
+				linkTags[src] = "frame"
+			}
+			if frameURL, err := resolveLink(finalURL, src); err == nil {
+				frameURL, _ = normalizeURL(urlRewriter.rewrite(frameURL), false)
+				if getHostname(frameURL) == getHostname(finalURL) {
+					follow(frameURL, "frame", depth)
+				}
+			}
+		}
+
+		// Iframes load whole documents of their own, so with -crawl-iframes they
+		// are processed as child pages, one level deeper like any followed link
+		for _, src := range pg.iframes {
+			if _, tagged := linkTags[src]; !tagged {
+				linkTags[src] = "iframe"
+			}
+			if !crawlIfrm {
+				continue
+			}
+			if iframeURL, err := resolveLink(finalURL, src); err == nil {
+				iframeURL, _ = normalizeURL(urlRewriter.rewrite(iframeURL), false)
+				iframeURL = wwwTwin(iframeURL)
+				if linkInScope(getHostname(iframeURL), targetHostname) && !blocked.blocks(iframeURL) {
+					follow(iframeURL, "iframe", depth+1)
+				}
+			}
+		}
+
+		// extCounts and extCapped track -limit-per-ext for this page; "" is URLs without an extension
+		extCounts := make(map[string]int)
+		extCapped := make(map[string]int)
+
+		// keep records a link that passed every check, or notes another source of a known one
+		keep := func(c keptLink) {
+			source := finalURL
+			if t := linkTags[c.link]; strings.HasPrefix(t, "pdf ") || strings.HasPrefix(t, "css ") {
+				source = t[len("pdf "):]
+			}
+
+			if _, done := urlLocales[c.resolved]; c.surfaced != nil && !done {
+				urlLocales[c.resolved] = c.surfaced
+			}
+			if fields, ok := pg.forms[c.link]; ok {
+				for _, name := range fields {
+					formFields[c.resolved] = appendUnique(formFields[c.resolved], name)
+				}
+			}
+
+			// Check for duplicates before storing
+			if !allExtractedURLs.has(c.resolved) {
+				if extLimit > 0 && extCounts[c.ext] >= extLimit {
+					extCapped[c.ext]++
+					return
+				}
+				extCounts[c.ext]++
+				record(c.resolved, source, targetURL, c.tag, c.external)
+			} else {
+				recall(c.resolved, targetURL, c.tag)
+			}
+			linkSource(c.resolved, source)
+		}
+
+		// PDFs and stylesheets to read for more links, and scripts waiting on
+		// their -min-js-size check, are fetched with mu released so other workers
+		// aren't held up by this page's side requests; the loop then carries on
+		// over the links they added
+		var docs []sideDoc
+		var sized []keptLink
+
+		// links may grow while looping as URLs are found inside linked documents
+		for j := 0; ; {
+			for ; j < len(links); j++ {
+				link := links[j]
+				parsedLink, err := url.Parse(link)
+				if err != nil {
+					continue
+				}
+				// Links that only some of the -probe-locales surfaced are attributed to them
+				var surfaced []string
+				if pageLocales != nil {
+					if abs, err := resolveLink(finalURL, link); err == nil && len(pageLocales[abs]) < len(locales) {
+						surfaced = pageLocales[abs]
+					}
+				}
+
+				resolvedLink := ""
+				if !parsedLink.IsAbs() {
+					baseURL, err := url.Parse(finalURL)
+					if err != nil {
+						continue
+					}
+					resolvedLink = baseURL.ResolveReference(parsedLink).String()
+				} else {
+					resolvedLink = parsedLink.String()
+				}
+
+				// Strip anchor fragments, keeping SPA routes when asked to
+				resolvedLink, spaRoute := normalizeURL(resolvedLink, keepSPA)
+				resolvedLink = wwwTwin(urlRewriter.rewrite(resolvedLink))
+				tag := linkTags[link]
+				if spaRoute {
+					tag = "spa-route"
+				}
+
+				// Emit double percent-encoded links both as found and singly decoded
+				if decoded, ok := decodeDoubleEncoding(resolvedLink); ok {
+					if _, tagged := linkTags[decoded]; !tagged {
+						linkTags[decoded] = "decoded"
+						links = append(links, decoded)
+					}
+					if tag == "" {
+						tag = "double-encoded"
+					}
+				}
+
+				resolvedLinkHostname := getHostname(resolvedLink)
+
+				// External links to trackers are noise even when the scope lets them
+				// in, so they are counted and dropped before recording or JS scanning
+				if !inScope(resolvedLinkHostname, targetHostname) && trackers.matches(resolvedLinkHostname) {
+					trackerURLs[resolvedLink] = struct{}{}
+					continue
+				}
+
+				// In-scope check
+				if !linkInScope(resolvedLinkHostname, targetHostname) {
+					if pg.blankTargets[link] && !excluded.matches(resolvedLink) {
+						if _, seen := blankLinks[resolvedLink]; !seen {
+							blankLinks[resolvedLink] = struct{}{}
+							if verbose {
+								fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] External target=_blank link:"), resolvedLink)
+							}
+						}
+					}
+					continue
+				}
+
+				// Explicitly out-of-scope URLs from -blocklist
+				if blocked.blocks(resolvedLink) {
+					if _, seen := blockedURLs[resolvedLink]; !seen {
+						blockedURLs[resolvedLink] = struct{}{}
+						if verbose {
+							fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Blocklisted:"), resolvedLink)
+						}
+					}
+					continue
+				}
+
+				// Skip if the link is a mailto, tel, or similar
+				if strings.HasPrefix(parsedLink.Scheme, "mail") || strings.HasPrefix(parsedLink.Scheme, "tel") {
+					continue
+				}
+
+				// Junk file and exclude checks, adjusted by any per-domain override. Social
+				// card images with a query string are usually rendered on the fly, so they're
+				// kept, as are <a download> links, which tend to be exports and backups.
+				_, override := overrides.lookup(resolvedLinkHostname)
+				dynamicCard := linkTags[link] == "meta-card" && parsedLink.RawQuery != ""
+				_, download := pg.downloads[link]
+				if (override.isJunk(parsedLink.Path) && !dynamicCard && !download) || override.excluded(resolvedLink) {
+					continue
+				}
+
+				// Fetch in-scope PDFs once and queue the URLs found inside them
+				if pdfMode && !noFollow && strings.HasSuffix(strings.ToLower(parsedLink.Path), ".pdf") && guards.allowsFetch(resolvedLink, depth+1) {
+					if _, done := fetchedPDFs[resolvedLink]; !done {
+						fetchedPDFs[resolvedLink] = struct{}{}
+						docs = append(docs, sideDoc{kind: "pdf", url: resolvedLink})
+					}
+				}
+
+				// Fetch in-scope stylesheets once and queue the URLs they reference
+				if parseCSS && !noFollow && strings.HasSuffix(strings.ToLower(parsedLink.Path), ".css") && guards.allowsFetch(resolvedLink, depth+1) {
+					if _, done := fetchedCSS[resolvedLink]; !done {
+						fetchedCSS[resolvedLink] = struct{}{}
+						docs = append(docs, sideDoc{kind: "css", url: resolvedLink})
+					}
+				}
+
+				if scanJS && !noFollow && strings.HasSuffix(strings.ToLower(parsedLink.Path), ".js") && guards.allowsFetch(resolvedLink, depth+1) {
+					if _, done := scannedJS[resolvedLink]; !done {
+						scannedJS[resolvedLink] = struct{}{}
+						scripts.add(jsJob{url: resolvedLink, target: targetURL, scope: targetHostname})
+					}
+				}
+
+				if jsOnly && !strings.HasSuffix(parsedLink.Path, ".js") {
+					continue
+				} else if !jsOnly && strings.HasSuffix(parsedLink.Path, ".js") {
+					continue
+				}
+
+				// Make sure the link isn't just the base URL itself
+				if resolvedLink == targetURL || resolvedLink == finalURL {
+					continue
+				}
+
+				// Drop overly long URLs, but never truncate them
+				if !keepLong && len(resolvedLink) > maxURLLen {
+					if !excluded.matches(resolvedLink) {
+						longURLs[resolvedLink] = struct{}{}
+					}
+					continue
+				}
+
+				c := keptLink{
+					link:     link,
+					resolved: resolvedLink,
+					tag:      tag,
+					ext:      strings.ToLower(path.Ext(parsedLink.Path)),
+					surfaced: surfaced,
+					external: !inScope(resolvedLinkHostname, targetHostname),
+				}
+
+				// Drop JS files below the size threshold, remembering them so each is only checked once
+				if jsOnly && minJSSize > 0 {
+					if _, small := smallJSURLs[resolvedLink]; small {
+						continue
+					}
+					if !allExtractedURLs.has(resolvedLink) {
+						sized = append(sized, c)
+						continue
+					}
+				}
+				keep(c)
+			}
+			if len(docs) == 0 && len(sized) == 0 {
+				break
+			}
+
+			mu.Unlock()
+			docLinks := make([][]string, len(docs))
+			for i, doc := range docs {
+				var err error
+				if doc.kind == "pdf" {
+					docLinks[i], err = fetchPDFLinks(ctx, client, doc.url, userAgent, maxBody)
+					if err != nil {
+						fmt.Fprintln(logOutput, color.YellowString("Warning: Skipping PDF"), color.YellowString(doc.url), "-", err)
+					}
+				} else {
+					docLinks[i], err = fetchCSSLinks(ctx, client, doc.url, userAgent, maxBody)
+					if err != nil {
+						fmt.Fprintln(logOutput, color.YellowString("Warning: Skipping stylesheet"), color.YellowString(doc.url), "-", err)
+					}
+				}
+			}
+			small := make(map[string]bool)
+			for _, c := range sized {
+				if _, checked := small[c.resolved]; checked {
+					continue
+				}
+				size, err := fetchSize(ctx, client, c.resolved, userAgent, minJSSize)
+				if err != nil {
+					fmt.Fprintln(logOutput, color.YellowString("Warning: Could not check size of"), color.YellowString(c.resolved), "-", err)
+				}
+				small[c.resolved] = err == nil && size < minJSSize
+			}
+			for _, l := range docLinks {
+				prepareScope(finalURL, l)
+			}
+			mu.Lock()
+
+			for i, doc := range docs {
+				for _, l := range docLinks[i] {
+					if _, tagged := linkTags[l]; !tagged {
+						linkTags[l] = doc.kind + " " + doc.url
+						links = append(links, l)
+					}
+				}
+			}
+			for _, c := range sized {
+				if small[c.resolved] {
+					smallJSURLs[c.resolved] = struct{}{}
+				} else {
+					keep(c)
+				}
+			}
+			docs, sized = nil, nil
+		}
+
+		if len(extCapped) > 0 {
+			exts := make([]string, 0, len(extCapped))
+			for ext, n := range extCapped {
+				if ext == "" {
+					ext = "(none)"
+				}
+				exts = append(exts, fmt.Sprintf("%s: %d", ext, n))
+			}
+			sort.Strings(exts)
+			fmt.Fprintln(logOutput, color.YellowString("Warning: -limit-per-ext dropped URLs from"), color.YellowString(targetURL), "-", strings.Join(exts, ", "))
+		}
+		if prior != nil {
+			newCount, knownCount := prior.counts(targetURL)
+			fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [INFO] %d new and %d known URLs from", newCount, knownCount)), color.YellowString(targetURL), "---")
+		}
+		return
+	}
+
+	// Workers take targets from urlsToProcess in order; the list may grow while they run.
+	// inFlight holds the indexes of the targets being processed.
+	next := 0
+	inFlight := make(map[int]struct{})
+	nextTarget := func() (int, string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		for next >= len(urlsToProcess) || baseCtx.Err() != nil {
+			if len(inFlight) == 0 || baseCtx.Err() != nil {
+				return 0, "", false
+			}
+			cond.Wait()
+		}
+		i := next
+		next++
+		inFlight[i] = struct{}{}
+		return i, urlsToProcess[i], true
+	}
+
+	// Once interrupted, the workers waiting for targets are woken to stop
+	go func() {
+		<-baseCtx.Done()
+		stopSignals()
+		fmt.Fprintln(logOutput, color.CyanString("--- [INFO] Interrupted, stopping the crawl and writing out the URLs found so far ---"))
+		mu.Lock()
+		cond.Broadcast()
+		mu.Unlock()
+	}()
+
+	// snapshot captures the crawl progress for -state; mu must be held
+	snapshot := func() *crawlState {
+		state := &crawlState{
+			Queued:    sortedKeys(queued),
+			Extracted: allExtractedURLs.sorted(),
+		}
+		if resumed != nil {
+			state.Done = append(state.Done, resumed.Done...)
+		}
+		for i := 0; i < next; i++ {
+			if _, busy := inFlight[i]; busy {
+				state.Frontier = append(state.Frontier, urlsToProcess[i])
+			} else {
+				state.Done = append(state.Done, urlsToProcess[i])
+			}
+		}
+		state.Frontier = append(state.Frontier, urlsToProcess[next:]...)
+		for _, u := range state.Frontier {
+			if depths[u] > 0 {
+				if state.Depths == nil {
+					state.Depths = make(map[string]int)
+				}
+				state.Depths[u] = depths[u]
+			}
+		}
+		return state
+	}
+
+	// Save the state periodically and when interrupted, until the workers are done
+	stopSaving := make(chan struct{})
+	savingDone := make(chan struct{})
+	if stateFile != "" {
+		save := func() {
+			mu.Lock()
+			state := snapshot()
+			mu.Unlock()
+			if err := saveState(stateFile, state); err != nil {
+				fmt.Fprintln(logOutput, color.YellowString("Warning: Could not save crawl state:"), err)
+			}
+		}
+		go func() {
+			defer close(savingDone)
+			ticker := time.NewTicker(stateInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					save()
+				case <-stopSaving:
+					// An interrupted crawl is saved once the workers have stopped
+					if baseCtx.Err() != nil {
+						save()
+						fmt.Fprintln(logOutput, color.CyanString("--- [INFO] Interrupted, crawl state saved to"), color.YellowString(stateFile), color.CyanString("---"))
+					}
+					return
+				}
+			}
+		}()
+	} else {
+		close(savingDone)
+	}
+
+	// scanScript fetches a script queued with -scan-js and records the in-scope
+	// endpoints quoted in it. It returns how many were new.
+	scanScript := func(ctx context.Context, job jsJob) (int, error) {
+		resp, err := fetchPage(ctx, job.url)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+		if err != nil {
+			return 0, err
+		}
+
+		endpoints := extractJSEndpoints(string(data))
+		prepareScope(job.url, endpoints)
+
+		mu.Lock()
+		defer mu.Unlock()
+		found := 0
+		for _, endpoint := range endpoints {
+			u, err := resolveLink(job.url, endpoint)
+			if err != nil {
+				continue
+			}
+			u, _ = normalizeURL(urlRewriter.rewrite(u), false)
+			u = wwwTwin(u)
+			parsed, err := url.Parse(u)
+			if err != nil || u == job.url {
+				continue
+			}
+			if !inScope(getHostname(u), job.scope) && trackers.matches(getHostname(u)) {
+				trackerURLs[u] = struct{}{}
+				continue
+			}
+			if !linkInScope(getHostname(u), job.scope) || blocked.blocks(u) {
+				continue
+			}
+			_, override := overrides.lookup(getHostname(u))
+			if override.isJunk(parsed.Path) || override.excluded(u) {
+				continue
+			}
+			if !keepLong && len(u) > maxURLLen {
+				if !excluded.matches(u) {
+					longURLs[u] = struct{}{}
+				}
+				continue
+			}
+			if !allExtractedURLs.has(u) {
+				record(u, job.url, job.target, "js-endpoint", false)
+				found++
+			} else {
+				recall(u, job.target, "js-endpoint")
+			}
+			linkSource(u, job.url)
+		}
+		return found, nil
+	}
+
+	// The script workers run until the page workers are done and the queue is drained
+	jsCtx, cancelJS := context.WithCancel(baseCtx)
+	if jsBudget > 0 {
+		jsCtx, cancelJS = context.WithTimeout(baseCtx, jsBudget)
+	}
+	defer cancelJS()
+	var scanners *jsPool
+	if scanJS {
+		scanners = startJSPool(jsCtx, scripts, jsWorkers, scanScript)
+	}
+
+	// With -auto-concurrency all -c workers run, but only limit.limit of them
+	// process a target at once
+	var limit *aimdLimit
+	if autoConc {
+		limit = newAIMDLimit(autoFloor, concurrency, autoWindow, autoErrRate)
+	}
+
+	crawlStart := time.Now()
+	seeds := append([]string(nil), urlsToProcess...)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if limit != nil {
+					limit.acquire()
+				}
+				i, u, ok := nextTarget()
+				if !ok {
+					if limit != nil {
+						limit.release()
+					}
+					return
+				}
+				failed := processTarget(u)
+				metrics.targetDone()
+				// A target cut short by an interrupt stays in the -state frontier
+				if baseCtx.Err() != nil {
+					if limit != nil {
+						limit.release()
+					}
+					return
+				}
+				if limit != nil {
+					if from, to := limit.done(failed); from != to && verbose {
+						fmt.Fprintln(logOutput, color.WhiteString("[VERBOSE] Concurrency:"), from, "->", to, fmt.Sprintf("(error rate %.0f%%)", 100*limit.rate()))
+					}
+				}
+
+				mu.Lock()
+				delete(inFlight, i)
+				cond.Broadcast()
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// No more scripts can be queued once the page workers are done
+	scripts.close()
+	if scanners != nil {
+		scanners.wait()
+	}
+	close(stopSaving)
+	<-savingDone
+
+	if hintsOut != "" {
+		now := time.Now()
+		// Hints applied but not confirmed keep their age; those that failed are
+		// dropped, unless an interrupt stopped the crawl before reaching them
+		for host, hint := range applied {
+			if hint.Scheme != "" && hostSchemes[host] == "" && baseCtx.Err() == nil {
+				hint.Scheme = ""
+				if hint.NoHTTP3 {
+					hints[host] = hint
+				} else {
+					delete(hints, host)
+				}
+			}
+		}
+		for host, scheme := range hostSchemes {
+			if _, unconfirmed := hintedSchemes[host]; !unconfirmed {
+				hint := hints[host]
+				hint.Scheme, hint.Updated = scheme, now
+				hints[host] = hint
+			}
+		}
+		for _, h3 := range h3Transports {
+			for _, host := range h3.skippedHosts() {
+				if !applied[host].NoHTTP3 {
+					hint := hints[host]
+					hint.NoHTTP3, hint.Updated = true, now
+					hints[host] = hint
+				}
+			}
+		}
+		if err := saveHints(hintsOut, hints); err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error writing hints to file:"), err)
+		} else {
+			fmt.Fprintln(logOutput, color.MagentaString(fmt.Sprintf("--- [OUTPUT] Hints for %d hosts written to", len(hints))), color.YellowString(hintsOut), "---")
+		}
+	}
+
+	if guards != nil && guards.hostCapped > 0 {
+		fmt.Fprintln(logOutput, color.YellowString(fmt.Sprintf("Warning: -max-hosts of %d reached, %d URLs on new hosts not followed", maxHosts, guards.hostCapped)))
+	}
+	if scanners != nil {
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Scanned %d scripts, finding %d new endpoints ---", scanners.scanned, scanners.endpoints)))
+		if scanners.skipped > 0 && baseCtx.Err() != nil {
+			fmt.Fprintln(logOutput, color.YellowString(fmt.Sprintf("Warning: Interrupted, %d scripts not scanned", scanners.skipped)))
+		} else if scanners.skipped > 0 {
+			fmt.Fprintln(logOutput, color.YellowString(fmt.Sprintf("Warning: -js-budget of %s used up, %d scripts not scanned", jsBudget, scanners.skipped)))
+		}
+	}
+
+	if failed := results.Close(); failed > 0 {
+		fmt.Fprintln(logOutput, color.YellowString(fmt.Sprintf("Warning: %d URLs could not be pushed to Redis", failed)))
+	}
+	if failed := producer.Close(); failed > 0 {
+		fmt.Fprintln(logOutput, color.YellowString(fmt.Sprintf("Warning: %d URLs could not be produced to Kafka", failed)))
+	}
+	if failed := indexer.Close(); failed > 0 {
+		fmt.Fprintln(logOutput, color.YellowString(fmt.Sprintf("Warning: %d URLs could not be indexed in Elasticsearch", failed)))
+	}
+
+	if len(longURLs) > 0 {
+		fmt.Fprintln(logOutput, color.YellowString(fmt.Sprintf("--- [INFO] Dropped %d URLs longer than %d characters ---", len(longURLs), maxURLLen)))
+		if longOut != "" {
+			var long []string
+			for u := range longURLs {
+				long = append(long, u)
+			}
+			if err := writeURLsToFile(longOut, long, writeOptions{lock: lockOutput, dedup: !noDedup}); err != nil {
+				fmt.Fprintln(logOutput, color.RedString("Error writing long URLs to file:"), err)
+			} else {
+				fmt.Fprintln(logOutput, color.MagentaString("--- [OUTPUT] Long URLs written to"), color.YellowString(longOut), "---")
+			}
+		}
+	}
+
+	if exportOut != "" {
+		state := exportedState{Started: crawlStart, Finished: time.Now(), Seeds: seeds}
+		for _, u := range sortedKeys(queued) {
+			if target, ok := exportTargets[u]; ok {
+				state.Targets = append(state.Targets, target)
+				if target.Error != "" {
+					state.Stats.Failed++
+				}
+			}
+		}
+		for _, u := range allExtractedURLs.sorted() {
+			entry, ok := exportURLs[u]
+			if !ok {
+				entry.URL = u
+			}
+			if target, ok := exportTargets[u]; ok {
+				entry.Status, entry.ContentType = target.Status, target.ContentType
+			}
+			state.Extracted = append(state.Extracted, entry)
+		}
+		state.Stats.Seeds = len(seeds)
+		state.Stats.Targets = len(state.Targets)
+		state.Stats.Extracted = len(state.Extracted)
+		state.Stats.External = exportExternal
+		state.Stats.Seconds = state.Finished.Sub(state.Started).Seconds()
+		data, err := json.MarshalIndent(state, "", "  ")
+		if err == nil {
+			err = os.WriteFile(exportOut, append(data, '\n'), 0644)
+		}
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error exporting crawl state:"), err)
+		} else {
+			fmt.Fprintln(logOutput, color.MagentaString("--- [OUTPUT] Crawl state exported to"), color.YellowString(exportOut), "---")
+		}
+	}
+
+	if graphOut != "" && len(linkSources) > 0 {
+		graph := make(map[string][]string, len(linkSources))
+		for u, sources := range linkSources {
+			graph[u] = sortedKeys(sources)
+		}
+		data, err := json.MarshalIndent(graph, "", "  ")
+		if err == nil {
+			err = os.WriteFile(graphOut, append(data, '\n'), 0644)
+		}
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error writing link graph to file:"), err)
+		} else {
+			fmt.Fprintln(logOutput, color.MagentaString("--- [OUTPUT] Link graph written to"), color.YellowString(graphOut), "---")
+		}
+	}
+
+	if len(hashRecords) > 0 {
+		if err := writeURLsToFile(hashOut, hashRecords, writeOptions{lock: lockOutput}); err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error writing body hashes to file:"), err)
+		} else {
+			fmt.Fprintln(logOutput, color.MagentaString("--- [OUTPUT] Body hashes written to"), color.YellowString(hashOut), "---")
+		}
+	}
+
+	if len(headerRecords) > 0 {
+		if err := writeURLsToFile(headersOut, headerRecords, writeOptions{lock: lockOutput}); err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error writing response headers to file:"), err)
+		} else {
+			fmt.Fprintln(logOutput, color.MagentaString("--- [OUTPUT] Response headers written to"), color.YellowString(headersOut), "---")
+		}
+	}
+
+	if len(sanHosts) > 0 {
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Found %d hostnames in TLS certificates ---", len(sanHosts))))
+		if certOut != "" {
+			if err := writeURLsToFile(certOut, sortedKeys(sanHosts), writeOptions{lock: lockOutput, dedup: !noDedup}); err != nil {
+				fmt.Fprintln(logOutput, color.RedString("Error writing certificate hostnames to file:"), err)
+			} else {
+				fmt.Fprintln(logOutput, color.MagentaString("--- [OUTPUT] Certificate hostnames written to"), color.YellowString(certOut), "---")
+			}
+		}
+	}
+
+	if len(commentHits) > 0 {
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Found %d interesting matches in HTML comments ---", len(commentHits))))
+	}
+
+	if len(blankLinks) > 0 {
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Found %d external target=_blank links ---", len(blankLinks))))
+		if blankOut != "" {
+			if err := writeURLsToFile(blankOut, sortedKeys(blankLinks), writeOptions{lock: lockOutput, dedup: !noDedup}); err != nil {
+				fmt.Fprintln(logOutput, color.RedString("Error writing target=_blank links to file:"), err)
+			} else {
+				fmt.Fprintln(logOutput, color.MagentaString("--- [OUTPUT] External target=_blank links written to"), color.YellowString(blankOut), "---")
+			}
+		}
+	}
+
+	if len(trackerURLs) > 0 {
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Blocked %d tracker URLs ---", len(trackerURLs))))
+	}
+
+	if len(blockedURLs) > 0 {
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Skipped %d blocklisted URLs ---", len(blockedURLs))))
+	}
+
+	if len(suppressed) > 0 {
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Suppressed %d URLs listed in the exclude file ---", len(suppressed))))
+	}
+
+	if len(slowBodies) > 0 {
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Cut off %d slow bodies after -max-body-read-time ---", len(slowBodies))))
+	}
+
+	if len(sizeDupes) > 0 {
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Skipped %d targets with a status and length already seen on their host ---", len(sizeDupes))))
+	}
+
+	if len(targetProtos) > 0 {
+		protoCounts := make(map[string]int)
+		protos := make(map[string]struct{})
+		for _, proto := range targetProtos {
+			protoCounts[proto]++
+			protos[proto] = struct{}{}
+		}
+		var counts []string
+		for _, proto := range sortedKeys(protos) {
+			counts = append(counts, fmt.Sprintf("%s: %d", proto, protoCounts[proto]))
+		}
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Targets fetched over %s ---", strings.Join(counts, ", "))))
+	}
+
+	if len(schemeCounts) > 0 {
+		fmt.Fprintln(logOutput, color.CyanString(fmt.Sprintf("--- [STATS] Schemeless targets answered over http: %d, https: %d ---", schemeCounts["http"], schemeCounts["https"])))
+	}
+
+	if len(downgrades) > 0 && downOut != "" {
+		if err := writeURLsToFile(downOut, downgrades, writeOptions{lock: lockOutput, dedup: !noDedup}); err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error writing downgrades to file:"), err)
+		} else {
+			fmt.Fprintln(logOutput, color.MagentaString("--- [OUTPUT] Redirect downgrades written to"), color.YellowString(downOut), "---")
+		}
+	}
+
+	// finalURLs are the URLs written out, after -rewrite-output. With
+	// -output-on-the-fly-sorted they are streamed from the spool instead, so
+	// that they are never all copied and sorted at once.
+	var finalURLs []string
+	// outputClasses and outputCounts hold the class and occurrences of each of the finalURLs
+	outputClasses := make(map[string]string)
+	outputCounts := make(map[string]int)
+	if spool == nil && len(outRewriter) > 0 {
+		rewritten := make(map[string]struct{})
+		for _, u := range allExtractedURLs.sorted() {
+			rewritten[outRewriter.rewrite(u)] = struct{}{}
+			outputClasses[outRewriter.rewrite(u)] = urlClasses[u]
+			outputCounts[outRewriter.rewrite(u)] += occurrences[u]
+		}
+		finalURLs = sortedKeys(rewritten)
+	} else if spool == nil {
+		for _, u := range allExtractedURLs.sorted() {
+			finalURLs = append(finalURLs, u)
+			outputClasses[u] = urlClasses[u]
+			outputCounts[u] = occurrences[u]
+		}
+	}
+	for _, u := range finalURLs {
+		// URLs restored from -state were found at least once, but not counted in this run
+		if outputCounts[u] == 0 {
+			outputCounts[u] = 1
+		}
+	}
+	if sortByCount {
+		sort.Slice(finalURLs, func(i, j int) bool {
+			if outputCounts[finalURLs[i]] != outputCounts[finalURLs[j]] {
+				return outputCounts[finalURLs[i]] > outputCounts[finalURLs[j]]
+			}
+			return finalURLs[i] < finalURLs[j]
+		})
+	}
+	// eachFinalURL calls fn with every URL written out, in no particular order
+	// and possibly more than once
+	eachFinalURL := func(fn func(string)) {
+		if spool == nil {
+			for _, u := range finalURLs {
+				fn(u)
+			}
+			return
+		}
+		// The spool holds the output lines, which lead with the class under -classify
+		if err := spool.merge(func(line string) error {
+			if classify {
+				_, line, _ = strings.Cut(line, "\t")
+			}
+			fn(line)
+			return nil
+		}); err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error reading the output spool:"), err)
+		}
+	}
+	extracted := allExtractedURLs.len() > 0
+
+	if paramOut != "" {
+		eachFinalURL(func(u string) {
+			if parsed, err := url.Parse(u); err == nil {
+				for name := range parsed.Query() {
+					paramNames[name] = struct{}{}
+				}
+			}
+		})
+		if len(paramNames) > 0 {
+			if err := writeURLsToFile(paramOut, sortedKeys(paramNames), writeOptions{lock: lockOutput, dedup: !noDedup}); err != nil {
+				fmt.Fprintln(logOutput, color.RedString("Error writing parameter names to file:"), err)
+			} else {
+				fmt.Fprintln(logOutput, color.MagentaString(fmt.Sprintf("--- [OUTPUT] %d parameter names written to", len(paramNames))), color.YellowString(paramOut), "---")
+			}
+		}
+	}
+
+	if extracted && wordOut != "" {
+		seen := make(map[string]struct{})
+		eachFinalURL(func(u string) {
+			addPathWords(seen, u)
+		})
+		words := sortedKeys(seen)
+		if err := writeURLsToFile(wordOut, words, writeOptions{lock: lockOutput, dedup: !noDedup}); err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error writing wordlist to file:"), err)
+		} else {
+			fmt.Fprintln(logOutput, color.MagentaString(fmt.Sprintf("--- [OUTPUT] %d words written to", len(words))), color.YellowString(wordOut), "---")
+		}
+	}
+
+	// outputLines are the lines written out, led by each URL's class with
+	// -classify and by its occurrences with -count-output
+	outputLines := finalURLs
+	if spool == nil && (classify || countOut) {
+		outputLines = make([]string, len(finalURLs))
+		for i, u := range finalURLs {
+			line := u
+			if classify {
+				// URLs restored from -state weren't classified while extracting
+				class := outputClasses[u]
+				if class == "" {
+					class = classes.classify(u, false)
+				}
+				line = class + "\t" + line
+			}
+			if countOut {
+				line = fmt.Sprintf("%d %s", outputCounts[u], line)
+			}
+			outputLines[i] = line
+		}
+	}
+
+	// eachLine calls emit with every output line in order; with
+	// -output-on-the-fly-sorted the lines are merged from the spool instead
+	eachLine := func(emit func(string) error) error {
+		for _, line := range outputLines {
+			if err := emit(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if spool != nil {
+		eachLine = spool.merge
+	}
+	printLines := func() {
+		if err := eachLine(func(line string) error {
+			_, err := fmt.Println(line)
+			return err
+		}); err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error writing extracted URLs:"), err)
+		}
+	}
+
+	if extracted && outputFile == "-" {
+		printLines()
+	} else if extracted && kafkaOnly {
+		fmt.Fprintln(logOutput, color.MagentaString("--- [OUTPUT] Extracted URLs produced to Kafka topic"), color.YellowString(kafkaTopic), "---")
+		if tee {
+			printLines()
+		}
+	} else if extracted {
+		err := writeLinesToFile(outputFile, eachLine, writeOptions{lock: lockOutput, dedup: !noDedup, maxSize: maxOutSize})
+		if err != nil {
+			fmt.Fprintln(logOutput, color.RedString("Error writing extracted URLs to file:"), err)
+		} else {
+			fmt.Fprintln(logOutput, color.MagentaString("--- [OUTPUT] Extracted URLs written to"), color.YellowString(outputFile), "---")
+		}
+		if tee {
+			printLines()
+		}
+	} else {
+		fmt.Fprintln(logOutput, color.YellowString("No URLs extracted. Either no links were found or the filters were too restrictive."))
+	}
+
+	// An interrupted crawl keeps its state to resume from and exits as Ctrl+C would
+	if baseCtx.Err() != nil {
+		os.Exit(130)
+	}
+	// The crawl finished, so there is nothing left to resume
+	if stateFile != "" {
+		if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintln(logOutput, color.YellowString("Warning: Could not remove state file:"), err)
+		}
+	}
+}
+
+// junkExtensions lists the common media and junk file extensions filtered out of the results.
+var junkExtensions = []string{
+	".css", ".jpeg", ".jpg", ".png", ".gif", ".svg", ".ico", ".webp",
+	".mp4", ".mov", ".avi", ".webm", ".mkv",
+	".woff", ".woff2", ".ttf", ".eot", ".otf",
+	".pdf", ".docx", ".xlsx", ".pptx", ".zip", ".rar", ".7z",
+	".xml",
+}
+
+// removeJunkExtension stops files with the given extension from being treated as junk.
+func removeJunkExtension(ext string) {
+	kept := junkExtensions[:0]
+	for _, e := range junkExtensions {
+		if e != ext {
+			kept = append(kept, e)
+		}
+	}
+	junkExtensions = kept
+}
+
+// isJunkFile checks if a file path ends with a common media or junk file extension.
+func isJunkFile(path string) bool {
+	for _, ext := range junkExtensions {
+		if strings.HasSuffix(strings.ToLower(path), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// keptLink is a link of a page that passed the scope and filter checks and
+// is about to be recorded.
+type keptLink struct {
+	// link is the link as found, which keys the page's tags, forms and
+	// downloads, and resolved its absolute, normalized form
+	link     string
+	resolved string
+	tag      string
+	ext      string
+	// surfaced holds the -probe-locales the link was found in, when not all
+	surfaced []string
+	external bool
+}
+
+// sideDoc is a PDF or stylesheet linked from a page, fetched for the links inside it.
+type sideDoc struct {
+	// kind is "pdf" or "css", which also starts the tag of the links found
+	kind string
+	url  string
+}
+
+// page holds everything extracted from a single HTML document.
+type page struct {
+	links     []string
+	canonical string
+	// frames holds the src of every <frame>, which are also part of links
+	frames []string
+	// iframes holds the src of every <iframe>, which are also part of links
+	iframes []string
+	// metaCards holds the URLs of social card <meta> tags, which are also part of links
+	metaCards []string
+	// configURLs holds the URLs found in inline script config objects, which are also part of links
+	configURLs []string
+	// title is the text of the first <title>, and snippet the start of the
+	// visible text outside scripts and styles, both with whitespace collapsed
+	title   string
+	snippet string
+	// headLinks holds the links that appear in the <head> and nowhere in the <body>
+	headLinks map[string]bool
+	// downloads maps the href of each <a download> to the suggested filename, which may be empty
+	downloads map[string]string
+	// blankTargets holds the href of each <a target="_blank">
+	blankTargets map[string]bool
+	// comments holds the text of every HTML comment
+	comments []string
+	// attrLinks maps the values of -attr attributes, which are also part of
+	// links, to the tag:attribute they came from
+	attrLinks map[string]string
+	// forms maps the action of each form, which is also part of links, to the
+	// names of its input, select and textarea fields; forms without an action
+	// are under ""
+	forms map[string][]string
+	// srcdocLinks holds the links found inside <iframe srcdoc> documents,
+	// which are also part of links
+	srcdocLinks map[string]bool
+	// noFollow is set when a robots meta tag says nofollow or none
+	noFollow bool
+	// err is set when reading the body failed part way, e.g. a truncated gzip
+	// stream; links holds whatever was extracted before the failure.
+	err error
+}
+
+// extractLinks parses HTML from an io.Reader and returns a list of links.
+func extractLinks(body io.Reader, baseURL string) []string {
+	return extractLinksFromTokenizer(html.NewTokenizer(body), baseURL)
+}
+
+// extractLinksFromTokenizer is extractLinks for a tokenizer the caller set
+// up, e.g. over a fixed string or with a maximum buffer size.
+func extractLinksFromTokenizer(z *html.Tokenizer, baseURL string) []string {
+	return extractPageFromTokenizer(z, baseURL).links
+}
+
+// extractPage parses HTML from an io.Reader and returns its links along with
+// page-level metadata such as the canonical URL.
+func extractPage(body io.Reader, baseURL string) page {
+	return extractPageFromTokenizer(html.NewTokenizer(body), baseURL)
+}
+
+// extractPageFromTokenizer is extractPage reading the tokens from z.
+func extractPageFromTokenizer(z *html.Tokenizer, baseURL string) page {
+	b := newPageBuilder()
+	return b.finish(b.consume(z))
+}
+
+// consume feeds the tokens of z to b until the input ends, returning the
+// error that ended it unless it was io.EOF.
+func (b *pageBuilder) consume(z *html.Tokenizer) error {
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return err
+			}
+			return nil
+		case html.CommentToken:
+			b.comment(string(z.Text()))
+		case html.TextToken:
+			b.text(string(z.Text()))
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			b.endTag(string(name))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			b.startTag(z.Token(), tt == html.SelfClosingTagToken)
+		}
+	}
+}
+
+// extractScopedPage is extractPage for -scope-selector: the whole document is
+// buffered and parsed, and links are only taken from subtrees matching sel.
+// The canonical URL still comes from the whole document.
+func extractScopedPage(body io.Reader, baseURL string, sel cascadia.Matcher) page {
+	data, readErr := io.ReadAll(body)
+	pg := extractPage(bytes.NewReader(data), baseURL)
+	if readErr != nil {
+		pg.err = readErr
+	}
+
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		pg.links = nil
+		if pg.err == nil {
+			pg.err = err
+		}
+		return pg
+	}
+
+	matched := make(map[*html.Node]bool)
+	var scoped bytes.Buffer
+	for _, n := range cascadia.QueryAll(doc, sel) {
+		matched[n] = true
+		// A match nested inside an earlier one was already rendered with it
+		nested := false
+		for p := n.Parent; p != nil; p = p.Parent {
+			if matched[p] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			html.Render(&scoped, n)
+		}
+	}
+	pg.links = extractPage(&scoped, baseURL).links
+	return pg
+}
+
+// blockTags are the elements that separate the text around them, so that
+// <p>one</p><p>two</p> reads as "one two" in a snippet.
+var blockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "td": true, "th": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"section": true, "article": true, "header": true, "footer": true, "nav": true,
+}
+
+// appendSnippet appends text to snippet with runs of whitespace collapsed to a
+// single space, keeping at most limit characters.
+func appendSnippet(snippet, text string, limit int) string {
+	if utf8.RuneCountInString(snippet) >= limit {
+		return snippet
+	}
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		if text != "" && snippet != "" && !strings.HasSuffix(snippet, " ") {
+			snippet += " "
+		}
+		return snippet
+	}
+	// Text split by inline tags, as in <b>H</b>ello, stays joined
+	if snippet != "" && !strings.HasSuffix(snippet, " ") && strings.TrimLeftFunc(text, unicode.IsSpace) != text {
+		snippet += " "
+	}
+	snippet += strings.Join(words, " ")
+	if strings.TrimRightFunc(text, unicode.IsSpace) != text {
+		snippet += " "
+	}
+	if runes := []rune(snippet); len(runes) > limit {
+		snippet = string(runes[:limit])
+	}
+	return snippet
+}
+
+// metaCardProperties are the social card <meta> properties whose content is a URL.
+var metaCardProperties = map[string]bool{
+	"og:image": true, "og:image:url": true, "og:image:secure_url": true,
+	"og:video": true, "og:video:url": true, "og:video:secure_url": true,
+	"og:audio": true, "og:audio:url": true, "og:audio:secure_url": true,
+	"twitter:image": true, "twitter:image:src": true, "twitter:player": true,
+}
+
+// metaCardURL returns the content of an Open Graph or Twitter card <meta> tag
+// naming an image, video, audio or player URL. Sites use either the property
+// or the name attribute for both kinds.
+func metaCardURL(token html.Token) (string, bool) {
+	var key, content string
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "property", "name":
+			key = strings.ToLower(strings.TrimSpace(attr.Val))
+		case "content":
+			content = strings.TrimSpace(attr.Val)
+		}
+	}
+	return content, metaCardProperties[key] && content != ""
+}
+
+// isMetaRobots reports whether a <meta> token has name="robots".
+func isMetaRobots(token html.Token) bool {
+	for _, attr := range token.Attr {
+		if attr.Key == "name" && strings.EqualFold(strings.TrimSpace(attr.Val), "robots") {
+			return true
+		}
+	}
+	return false
+}
+
+// robotsNoFollow reports whether a robots directive list, from a meta tag or
+// an X-Robots-Tag header, includes nofollow or none.
+func robotsNoFollow(directives string) bool {
+	for _, d := range strings.Split(directives, ",") {
+		switch strings.ToLower(strings.TrimSpace(d)) {
+		case "nofollow", "none":
+			return true
+		}
+	}
+	return false
+}
+
+// xRobotsNoFollow reports whether X-Robots-Tag header values say nofollow or
+// none. Values aimed at one crawler, as in "googlebot: nofollow", are skipped.
+func xRobotsNoFollow(values []string) bool {
+	for _, value := range values {
+		if name, _, ok := strings.Cut(value, ":"); ok && !strings.ContainsAny(strings.TrimSpace(name), ", ") && !strings.EqualFold(strings.TrimSpace(name), "unavailable_after") {
+			continue
+		}
+		if robotsNoFollow(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// addPathWords adds the path segments (directory and file names) of u to
+// words, for -wordlist.
+func addPathWords(words map[string]struct{}, u string) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return
+	}
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			words[segment] = struct{}{}
+		}
+	}
+}
+
+var (
+	// htmlEntity matches semicolon-terminated HTML entities; entities without a
+	// semicolon are left alone since "&lt=1" is a legitimate query string
+	htmlEntity = regexp.MustCompile(`&(?:[a-zA-Z][a-zA-Z0-9]*|#[0-9]+|#[xX][0-9a-fA-F]+);`)
+	// doubleEncoded matches a percent-encoded percent sign followed by two hex digits, e.g. %2520
+	doubleEncoded = regexp.MustCompile(`%25([0-9a-fA-F]{2})`)
+)
+
+// decodeEntities decodes the semicolon-terminated HTML entities in a link
+// taken from raw text, such as an inline script, which the tokenizer leaves
+// encoded. Attribute values are decoded by the tokenizer already, and decoding
+// them again would turn a literal &amp;amp; into & rather than &amp;.
+func decodeEntities(link string) string {
+	if !strings.Contains(link, "&") {
+		return link
+	}
+	return htmlEntity.ReplaceAllStringFunc(link, html.UnescapeString)
+}
+
+// decodeDoubleEncoding undoes one level of percent-encoding for sequences that
+// look double-encoded (%2520 -> %20, %252F -> %2F). Nothing else in the URL is
+// touched, so a URL that legitimately contains %25 is still emitted unchanged
+// alongside the decoded form. It reports whether anything was decoded.
+func decodeDoubleEncoding(link string) (string, bool) {
+	decoded := doubleEncoded.ReplaceAllString(link, "%$1")
+	return decoded, decoded != link
+}
+
+// isSPARoute reports whether a URL fragment looks like a client-side route
+// (#/admin or #!/admin) rather than a plain anchor such as #section.
+func isSPARoute(fragment string) bool {
+	return strings.HasPrefix(fragment, "/") || strings.HasPrefix(fragment, "!/")
+}
+
+// normalizeURL strips the fragment from u, including an empty one left by a
+// trailing #. With keepSPA set, route-like fragments are kept instead and
+// reported as an SPA route.
+func normalizeURL(u string, keepSPA bool) (string, bool) {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Fragment == "" && !strings.HasSuffix(u, "#") {
+		return u, false
+	}
+	if keepSPA && isSPARoute(parsed.Fragment) {
+		return parsed.String(), true
+	}
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	return parsed.String(), false
+}
+
+// inScope reports whether hostname is the target hostname or one of its subdomains.
+func inScope(hostname, targetHostname string) bool {
+	return hostname == targetHostname || strings.HasSuffix(hostname, "."+targetHostname)
+}
+
+// httpMethods are the request methods recognized at the start of request-line input.
+var httpMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "OPTIONS": true, "TRACE": true, "CONNECT": true,
+}
+
+// normalizeTarget turns input lines that aren't bare URLs into something the
+// scheme-prepending logic can handle. It strips the method and protocol from
+// "GET https://host/path HTTP/1.1" lines, brackets raw IPv6 addresses, and
+// picks a scheme for host:port pairs by port convention. The returned note
+// describes the transformation applied, if any.
+func normalizeTarget(line string) (string, string) {
+	target := strings.TrimSpace(line)
+	var notes []string
+
+	if fields := strings.Fields(target); len(fields) >= 2 && httpMethods[fields[0]] {
+		target = fields[1]
+		notes = append(notes, "stripped "+fields[0]+" request line")
+	}
+	if strings.Contains(target, "://") {
+		return escapeZone(target), strings.Join(notes, ", ")
+	}
+
+	hostport, rest := target, ""
+	if i := strings.IndexAny(target, "/?#"); i >= 0 {
+		hostport, rest = target[:i], target[i:]
+	}
+
+	if ip := parseIPHost(hostport); ip != nil && strings.Contains(hostport, ":") && !strings.HasPrefix(hostport, "[") {
+		hostport = "[" + hostport + "]"
+		notes = append(notes, "bracketed IPv6 address")
+	}
+	hostport = escapeZone(hostport)
+
+	if _, port, err := net.SplitHostPort(hostport); err == nil && port != "" {
+		scheme := "http://"
+		if port == "443" || port == "8443" {
+			scheme = "https://"
+		}
+		notes = append(notes, "chose "+strings.TrimSuffix(scheme, "://")+" for port "+port)
+		return scheme + hostport + rest, strings.Join(notes, ", ")
+	}
+	return hostport + rest, strings.Join(notes, ", ")
+}
+
+// storedHeaders are the response headers recorded with -store-headers.
+var storedHeaders = []string{
+	"Server", "X-Powered-By", "Content-Type",
+	"Content-Security-Policy", "Strict-Transport-Security", "X-Frame-Options",
+	"X-Content-Type-Options", "Referrer-Policy", "Permissions-Policy",
+	"Access-Control-Allow-Origin",
+}
+
+// headerRecord is the per-target record written with -store-headers.
+type headerRecord struct {
+	URL     string            `json:"url"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Cookies []string          `json:"cookies,omitempty"`
+	Title   string            `json:"title,omitempty"`
+	// Snippet is the start of the page's visible text, up to -snippet-length characters
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// newHeaderRecord builds a headerRecord from the selected headers of resp.
+// Only the names of cookies are kept, never their values.
+func newHeaderRecord(targetURL string, resp *http.Response) headerRecord {
+	record := headerRecord{URL: targetURL, Status: resp.StatusCode, Headers: make(map[string]string)}
+	for _, name := range storedHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			record.Headers[name] = strings.Join(values, ", ")
+		}
+	}
+	for _, cookie := range resp.Cookies() {
+		record.Cookies = append(record.Cookies, cookie.Name)
+	}
+	return record
+}
+
+// isTLSError reports whether err was caused by a certificate or TLS handshake failure.
+func isTLSError(err error) bool {
+	return strings.Contains(err.Error(), "x509: certificate") || strings.Contains(err.Error(), "tls:")
+}
+
+// isTLSOrTimeout reports whether err was caused by a TLS failure or a timeout.
+func isTLSOrTimeout(err error) bool {
+	var netErr net.Error
+	return isTLSError(err) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// isRefusedOrReset reports whether err was caused by a refused or reset connection.
+func isRefusedOrReset(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		strings.Contains(err.Error(), "connection refused") || strings.Contains(err.Error(), "connection reset")
+}
+
+// redirectPolicy returns the CheckRedirect of the crawl client. It fails
+// redirect chains that revisit a URL with errRedirectLoop and chains longer
+// than maxRedir; with maxRedir 0 the first redirect is returned as the
+// response. Each chain with an https to http hop is warned about and passed
+// to downgrade.
+func redirectPolicy(maxRedir int, downgrade func(chain string)) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		chain := redirectChain(req, via)
+		for _, prev := range via {
+			if prev.URL.String() == req.URL.String() {
+				return fmt.Errorf("%w: %s", errRedirectLoop, chain)
+			}
+		}
+		if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme == "http" {
+			fmt.Fprintln(logOutput, color.YellowString("Warning: Redirect downgrades to http:"), chain)
+			downgrade(chain)
+		}
+		if maxRedir <= 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > maxRedir {
+			return fmt.Errorf("stopped after %d redirects (raise -max-redirects to follow more)", maxRedir)
+		}
+		return nil
+	}
+}
+
+// redirectChain formats the URLs visited so far, ending with req, as "a -> b -> c".
+func redirectChain(req *http.Request, via []*http.Request) string {
+	hops := make([]string, 0, len(via)+1)
+	for _, r := range via {
+		hops = append(hops, r.URL.String())
+	}
+	return strings.Join(append(hops, req.URL.String()), " -> ")
+}
+
+// isCanonical reports whether a <link> token has rel="canonical".
+func isCanonical(token html.Token) bool {
+	for _, attr := range token.Attr {
+		if attr.Key == "rel" {
+			for _, rel := range strings.Fields(attr.Val) {
+				if strings.EqualFold(rel, "canonical") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// resolveLink resolves link against base and returns the absolute URL.
+func resolveLink(base, link string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	parsedLink, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	return baseURL.ResolveReference(parsedLink).String(), nil
+}
+
+// stringList is a flag.Value collecting every use of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseStatusCodes parses a comma-separated list of HTTP status codes into a set.
+func parseStatusCodes(list string) (map[int]bool, error) {
+	codes := make(map[int]bool)
+	for _, code := range strings.Split(list, ",") {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		n, err := strconv.Atoi(code)
+		if err != nil || n < 100 || n > 999 {
+			return nil, fmt.Errorf("invalid status code %q", code)
+		}
+		codes[n] = true
+	}
+	return codes, nil
+}
+
+// parseDNSServers parses a comma-separated list of DNS servers, adding the
+// default port 53 to entries that don't specify one.
+func parseDNSServers(list string) ([]string, error) {
+	var servers []string
+	for _, server := range strings.Split(list, ",") {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		servers = append(servers, server)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no DNS servers given")
+	}
+	return servers, nil
+}
+
+// loadHostsFile parses a hosts file into a map of lowercased hostnames to IP addresses.
+// Both IPv4 and IPv6 entries are supported; comments and invalid lines are ignored.
+func loadHostsFile(filename string) (map[string][]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hosts := make(map[string][]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := fields[0]
+		if parseIPHost(ip) == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			name = hostKey(name)
+			hosts[name] = append(hosts[name], ip)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// hostsDialContext wraps a dialFunc so that hostnames found in hosts are dialed
+// directly by IP, falling back to the wrapped dialer for everything else.
+func hostsDialContext(hosts map[string][]string, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return dial(ctx, network, address)
+		}
+		ips, ok := hosts[hostKey(host)]
+		if !ok {
+			return dial(ctx, network, address)
+		}
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// ipLiteralDialContext wraps a dialFunc so that addresses whose host is a
+// numeric IPv4 or IPv6 literal are dialed with plain instead, bypassing
+// whatever resolver the wrapped dialer is configured with.
+func ipLiteralDialContext(plain *net.Dialer, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil && parseIPHost(host) != nil {
+			return plain.DialContext(ctx, network, address)
+		}
+		return dial(ctx, network, address)
+	}
+}
+
+// localAddress returns the address to dial from: sourceIP when set, which
+// must be an address of this host, otherwise the first address of the named
+// interface, preferring IPv4.
+func localAddress(sourceIP, ifaceName string) (net.IP, error) {
+	if sourceIP != "" {
+		ip := net.ParseIP(sourceIP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source IP %q", sourceIP)
+		}
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return ip, nil
+			}
+		}
+		return nil, fmt.Errorf("%s is not an address of this host", sourceIP)
+	}
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var ipv6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+		if ipv6 == nil {
+			ipv6 = ipNet.IP
+		}
+	}
+	if ipv6 == nil {
+		return nil, fmt.Errorf("interface %s has no usable address", ifaceName)
+	}
+	return ipv6, nil
+}
+
+// isPrivateIP reports whether ip is in a private, loopback, link-local or unspecified range.
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// privateGuardDialContext wraps a dialFunc and closes any connection whose remote
+// address is private. The check runs on the established connection, before any
+// bytes are sent, so a DNS rebinding answer can't slip past an earlier lookup.
+func privateGuardDialContext(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok && isPrivateIP(tcpAddr.IP) {
+			conn.Close()
+			return nil, fmt.Errorf("connection to private address %s blocked", tcpAddr.IP)
+		}
+		return conn, nil
+	}
+}
+
+// socks5DialContext returns a dialFunc that connects through the SOCKS5 proxy at
+// proxyAddr, which may carry credentials as user:pass@host:port.
+func socks5DialContext(proxyAddr string, forward proxy.Dialer) (dialFunc, error) {
+	if !strings.Contains(proxyAddr, "://") {
+		proxyAddr = "socks5://" + proxyAddr
+	}
+	proxyURL, err := url.Parse(proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme != "socks5" && proxyURL.Scheme != "socks5h" {
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+
+	var auth *proxy.Auth
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+	}
+
+	d, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, forward)
+	if err != nil {
+		return nil, err
+	}
+	contextDialer, ok := d.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("SOCKS5 dialer does not support contexts")
+	}
+	return contextDialer.DialContext, nil
+}
+
+// fetchBody downloads u and returns at most maxBody bytes of a 200 OK response body.
+func fetchBody(ctx context.Context, client *http.Client, u, userAgent string, maxBody int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxBody))
+}
+
+// fetchSize returns the size of the resource at u using the Content-Length of a HEAD
+// request, falling back to reading at most limit bytes of a GET response.
+func fetchSize(ctx context.Context, client *http.Client, u, userAgent string, limit int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && resp.ContentLength >= 0 {
+		return resp.ContentLength, nil
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err = client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.Copy(io.Discard, io.LimitReader(resp.Body, limit))
+}
+
+// readURLsFromFile reads a list of URLs from a file.
+func readURLsFromFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		urls = append(urls, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// getHostname extracts the hostname from a URL, as a hostKey.
+func getHostname(u string) string {
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return hostKey(parsedURL.Hostname())
+}
 
 // writeURLsToFile writes a slice of URLs to a file, one per line, in append mode.
-func writeURLsToFile(filename string, urls []string) error {
-	// Open the file with append, create, and write permissions
-	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// Files ending in .gz are gzip-compressed, each write appending a new gzip member.
+// With opts.dedup set, URLs already present in the file (or its rotated parts) are
+// skipped. With opts.lock set, the file is locked for the duration of the write and
+// URLs already present near the end of the file (e.g. from a concurrent run) are
+// skipped even without dedup.
+func writeURLsToFile(filename string, urls []string, opts writeOptions) error {
+	return writeLinesToFile(filename, func(emit func(string) error) error {
+		for _, u := range urls {
+			if err := emit(u); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, opts)
+}
+
+// writeLinesToFile is writeURLsToFile for lines that are streamed rather than
+// held in a slice: eachLine calls its argument with every line in turn.
+func writeLinesToFile(filename string, eachLine func(emit func(string) error) error, opts writeOptions) error {
+	out, err := openRotatingFile(filename, opts.maxSize, opts.lock)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if opts.lock || opts.dedup {
+		existing := make(map[string]struct{})
+		if opts.dedup {
+			for _, part := range out.parts() {
+				if err := readExistingLines(part, existing); err != nil {
+					return err
+				}
+			}
+		} else {
+			var tail map[string]struct{}
+			if out.compressed {
+				// A gzip stream can't be read from the middle, so read it all
+				tail, err = readGzipLines(out.file)
+			} else {
+				tail, err = readFileTail(out.file, outputTailSize)
+			}
+			if err != nil {
+				return err
+			}
+			existing = tail
+		}
+
+		all := eachLine
+		eachLine = func(emit func(string) error) error {
+			return all(func(u string) error {
+				if _, ok := existing[u]; ok {
+					return nil
+				}
+				return emit(u)
+			})
+		}
+	}
+
+	if err := eachLine(out.WriteLine); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// readExistingLines adds every line of the named file to lines.
+func readExistingLines(filename string, lines map[string]struct{}) error {
+	file, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	for _, u := range urls {
-		_, err := writer.WriteString(u + "\n")
+	var found map[string]struct{}
+	if strings.HasSuffix(filename, ".gz") {
+		found, err = readGzipLines(file)
+	} else {
+		found, err = readFileTail(file, math.MaxInt64)
+	}
+	for line := range found {
+		lines[line] = struct{}{}
+	}
+	return err
+}
+
+// readFileTail returns the set of lines found in the last maxBytes of file.
+// A partial first line is discarded when the file is larger than maxBytes.
+func readFileTail(file *os.File, maxBytes int64) (map[string]struct{}, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - maxBytes
+	if offset < 0 {
+		offset = 0
+	}
+
+	lines := make(map[string]struct{})
+	first := true
+	err = eachFileLine(io.NewSectionReader(file, offset, info.Size()-offset), func(line string) {
+		if first && offset > 0 {
+			first = false
+			return
+		}
+		first = false
+		lines[line] = struct{}{}
+	})
+	return lines, err
+}
+
+// readGzipLines returns the set of lines in a gzip-compressed file, which may
+// consist of several concatenated gzip members. An empty file has no lines.
+func readGzipLines(file *os.File) (map[string]struct{}, error) {
+	lines := make(map[string]struct{})
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return lines, err
+	}
+
+	gz, err := gzip.NewReader(io.NewSectionReader(file, 0, info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	err = eachFileLine(gz, func(line string) {
+		lines[line] = struct{}{}
+	})
+	return lines, err
+}
+
+// eachFileLine calls fn with every line read from r, without its line ending.
+// Unlike a bufio.Scanner it has no limit on the length of a line, as output
+// files may hold minified JSON or HAR entries far longer than 64KB.
+func eachFileLine(r io.Reader, fn func(line string)) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			fn(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+		}
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
 	}
-	return writer.Flush()
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// crawlGuards decides which discovered URLs may be followed, i.e. queued as
+// targets or fetched to look for more links. URLs that aren't followed are
+// still recorded as findings.
+type crawlGuards struct {
+	// exclude matches URLs that are never followed, from -crawl-exclude
+	exclude []*regexp.Regexp
+	// caps limit the depth at which matching URLs are followed, from -depth-cap
+	caps []depthCap
+	// maxHosts stops the crawl from following URLs on new hosts once this many
+	// distinct hosts have been followed, from -max-hosts; 0 means no limit
+	maxHosts int
+	hosts    map[string]struct{}
+	// hostCapped counts the URLs not followed because of maxHosts
+	hostCapped int
+}
+
+// depthCap limits how deep the crawl follows URLs matching a pattern.
+type depthCap struct {
+	re    *regexp.Regexp
+	depth int
+}
+
+// parseDepthCap parses "pattern:depth", e.g. "/calendar/:1". The depth follows
+// the last colon so that the pattern itself may contain colons.
+func parseDepthCap(s string) (depthCap, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return depthCap{}, fmt.Errorf("invalid depth cap %q (expected pattern:depth)", s)
+	}
+	depth, err := strconv.Atoi(s[i+1:])
+	if err != nil || depth < 0 {
+		return depthCap{}, fmt.Errorf("invalid depth in %q", s)
+	}
+	re, err := regexp.Compile(s[:i])
+	if err != nil {
+		return depthCap{}, fmt.Errorf("invalid depth cap pattern in %q: %w", s, err)
+	}
+	return depthCap{re: re, depth: depth}, nil
+}
+
+// addHost counts host towards -max-hosts, e.g. for the targets given on the
+// command line, which are crawled whatever the cap.
+func (g *crawlGuards) addHost(host string) {
+	if g == nil || g.maxHosts <= 0 {
+		return
+	}
+	if g.hosts == nil {
+		g.hosts = make(map[string]struct{})
+	}
+	g.hosts[hostKey(host)] = struct{}{}
+}
+
+// allows reports whether u may be followed at depth, where the targets given
+// on the command line are at depth 0. A nil crawlGuards allows everything.
+// Allowing a URL counts its host towards -max-hosts.
+func (g *crawlGuards) allows(u string, depth int) bool {
+	if !g.allowsFetch(u, depth) {
+		return false
+	}
+	if g != nil && g.maxHosts > 0 {
+		host := getHostname(u)
+		if _, seen := g.hosts[host]; !seen {
+			if len(g.hosts) >= g.maxHosts {
+				g.hostCapped++
+				return false
+			}
+			g.addHost(host)
+		}
+	}
+	return true
+}
+
+// allowsFetch reports whether u may be fetched at depth only to extract the
+// links in it, as PDFs, stylesheets and scripts are. -max-hosts doesn't apply,
+// so that asset CDNs don't use up the hosts meant for crawled targets.
+func (g *crawlGuards) allowsFetch(u string, depth int) bool {
+	if g == nil {
+		return true
+	}
+	for _, re := range g.exclude {
+		if re.MatchString(u) {
+			return false
+		}
+	}
+	for _, c := range g.caps {
+		if depth > c.depth && c.re.MatchString(u) {
+			return false
+		}
+	}
+	return true
+}
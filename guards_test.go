@@ -0,0 +1,94 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestParseDepthCap(t *testing.T) {
+	tests := []struct {
+		in      string
+		pattern string
+		depth   int
+		wantErr bool
+	}{
+		{"/calendar/:1", "/calendar/", 1, false},
+		{`https?://[^/]+:8080/:0`, `https?://[^/]+:8080/`, 0, false},
+		{"/calendar/", "", 0, true},
+		{"/calendar/:x", "", 0, true},
+		{"/calendar/:-1", "", 0, true},
+		{"(:2", "", 0, true},
+	}
+	for _, tt := range tests {
+		c, err := parseDepthCap(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDepthCap(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (c.re.String() != tt.pattern || c.depth != tt.depth) {
+			t.Errorf("parseDepthCap(%q) = %q:%d, want %q:%d", tt.in, c.re, c.depth, tt.pattern, tt.depth)
+		}
+	}
+}
+
+func TestCrawlGuardsRules(t *testing.T) {
+	g := &crawlGuards{
+		exclude: []*regexp.Regexp{regexp.MustCompile(`/logout`)},
+		caps:    []depthCap{{re: regexp.MustCompile(`/calendar/`), depth: 1}},
+	}
+	tests := []struct {
+		u     string
+		depth int
+		want  bool
+	}{
+		{"https://example.com/page", 5, true},
+		{"https://example.com/logout", 0, false},
+		{"https://example.com/calendar/2024", 1, true},
+		{"https://example.com/calendar/2024", 2, false},
+	}
+	for _, tt := range tests {
+		if got := g.allows(tt.u, tt.depth); got != tt.want {
+			t.Errorf("allows(%q, %d) = %v, want %v", tt.u, tt.depth, got, tt.want)
+		}
+		if got := g.allowsFetch(tt.u, tt.depth); got != tt.want {
+			t.Errorf("allowsFetch(%q, %d) = %v, want %v", tt.u, tt.depth, got, tt.want)
+		}
+	}
+
+	var none *crawlGuards
+	if !none.allows("https://example.com/logout", 9) || !none.allowsFetch("https://example.com/logout", 9) {
+		t.Error("nil guards refused a URL")
+	}
+}
+
+func TestCrawlGuardsMaxHosts(t *testing.T) {
+	g := &crawlGuards{maxHosts: 2}
+	g.addHost("Example.com")
+
+	// Side fetches from asset hosts don't use up the cap
+	for _, u := range []string{"https://cdn.example.net/app.js", "https://fonts.example.org/site.css"} {
+		if !g.allowsFetch(u, 1) {
+			t.Errorf("allowsFetch(%q) = false", u)
+		}
+	}
+	steps := []struct {
+		u    string
+		want bool
+	}{
+		{"https://example.com/a", true},
+		{"https://api.example.com/", true},
+		{"https://other.example.com/", false},
+		// Hosts already counted stay allowed, however they are written
+		{"https://API.example.com:8443/x", true},
+		{"https://example.com./b", true},
+		{"https://third.example.com/", false},
+	}
+	for _, step := range steps {
+		if got := g.allows(step.u, 1); got != step.want {
+			t.Errorf("allows(%q) = %v, want %v", step.u, got, step.want)
+		}
+	}
+	if g.hostCapped != 2 || len(g.hosts) != 2 {
+		t.Errorf("hostCapped %d with %d hosts, want 2 with 2", g.hostCapped, len(g.hosts))
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2PushTimeout bounds a push probe when the target has no -target-budget.
+const h2PushTimeout = 10 * time.Second
+
+// fetchH2Pushes requests u over a dedicated HTTP/2 connection with server push
+// enabled and returns the URLs of the resources the server promised to push.
+// net/http's client always disables push, so the probe speaks the frames
+// itself. Servers that don't negotiate h2 yield no URLs and no error.
+func fetchH2Pushes(ctx context.Context, dial dialFunc, insecure bool, u, userAgent string) ([]string, error) {
+	target, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "https" {
+		return nil, nil
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h2PushTimeout)
+		defer cancel()
+	}
+
+	port := target.Port()
+	if port == "" {
+		port = "443"
+	}
+	raw, err := dial(ctx, "tcp", net.JoinHostPort(target.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(raw, &tls.Config{ServerName: target.Hostname(), NextProtos: []string{http2.NextProtoTLS}, InsecureSkipVerify: insecure})
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	if conn.ConnectionState().NegotiatedProtocol != http2.NextProtoTLS {
+		return nil, nil
+	}
+
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		return nil, err
+	}
+	framer := http2.NewFramer(conn, conn)
+	if err := framer.WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 1}); err != nil {
+		return nil, err
+	}
+
+	var request bytes.Buffer
+	encoder := hpack.NewEncoder(&request)
+	for _, field := range []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: target.Host},
+		{Name: ":path", Value: target.RequestURI()},
+		{Name: "user-agent", Value: userAgent},
+	} {
+		encoder.WriteField(field)
+	}
+	if err := framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: request.Bytes(), EndStream: true, EndHeaders: true}); err != nil {
+		return nil, err
+	}
+
+	// One decoder sees every header block, as they share the connection's table
+	decoder := hpack.NewDecoder(4096, nil)
+	var (
+		pushed []string
+		// block collects a header block split over CONTINUATION frames
+		block   []byte
+		promise bool
+	)
+	endBlock := func() error {
+		fields, err := decoder.DecodeFull(block)
+		block = nil
+		if err != nil || !promise {
+			return err
+		}
+		var scheme, authority, path string
+		for _, f := range fields {
+			switch f.Name {
+			case ":scheme":
+				scheme = f.Value
+			case ":authority":
+				authority = f.Value
+			case ":path":
+				path = f.Value
+			}
+		}
+		if authority == "" {
+			authority = target.Host
+		}
+		if scheme != "" && path != "" {
+			pushed = append(pushed, scheme+"://"+authority+path)
+		}
+		return nil
+	}
+
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			// Whatever was promised before the connection failed is still worth keeping
+			var netErr net.Error
+			if len(pushed) > 0 || errors.As(err, &netErr) && netErr.Timeout() {
+				return pushed, nil
+			}
+			return nil, err
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				framer.WriteSettingsAck()
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				framer.WritePing(true, f.Data)
+			}
+		case *http2.PushPromiseFrame:
+			block, promise = append(block, f.HeaderBlockFragment()...), true
+			if f.HeadersEnded() {
+				if err := endBlock(); err != nil {
+					return pushed, err
+				}
+			}
+		case *http2.HeadersFrame:
+			block, promise = append(block, f.HeaderBlockFragment()...), false
+			if f.HeadersEnded() {
+				if err := endBlock(); err != nil {
+					return pushed, err
+				}
+			}
+			if f.StreamID == 1 && f.StreamEnded() {
+				return pushed, nil
+			}
+		case *http2.ContinuationFrame:
+			block = append(block, f.HeaderBlockFragment()...)
+			if f.HeadersEnded() {
+				if err := endBlock(); err != nil {
+					return pushed, err
+				}
+			}
+		case *http2.DataFrame:
+			// Keep the windows open so pushed bodies can't stall the response
+			if n := f.Length; n > 0 {
+				framer.WriteWindowUpdate(0, n)
+				framer.WriteWindowUpdate(f.StreamID, n)
+			}
+			if f.StreamID == 1 && f.StreamEnded() {
+				return pushed, nil
+			}
+		case *http2.RSTStreamFrame:
+			if f.StreamID == 1 {
+				return pushed, nil
+			}
+		case *http2.GoAwayFrame:
+			return pushed, nil
+		}
+	}
+}
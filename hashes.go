@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html/charset"
+)
+
+// shingleSize is the number of consecutive words hashed together by simhash.
+const shingleSize = 3
+
+// pageHash is the per-target record written with -hashes-out.
+type pageHash struct {
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+	Simhash string `json:"simhash"`
+}
+
+// newPageHash hashes a decoded page body. The SHA-256 detects any change at
+// all while the simhash changes only a little when the content changes a little.
+func newPageHash(targetURL string, body []byte) pageHash {
+	sum := sha256.Sum256(body)
+	return pageHash{
+		URL:     targetURL,
+		SHA256:  hex.EncodeToString(sum[:]),
+		Simhash: formatSimhash(simhash(string(body))),
+	}
+}
+
+// simhash returns a 64-bit simhash of text built from overlapping shingles of
+// shingleSize lowercased words. Similar texts get hashes a small Hamming distance apart.
+func simhash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	add := func(shingle string) {
+		h := fnv.New64a()
+		h.Write([]byte(shingle))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	if len(words) < shingleSize {
+		add(strings.Join(words, " "))
+	}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		add(strings.Join(words[i:i+shingleSize], " "))
+	}
+
+	var hash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash
+}
+
+// hammingDistance returns the number of bits that differ between two simhashes.
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// formatSimhash encodes a simhash as 16 hex digits, as JSON numbers can't hold every uint64.
+func formatSimhash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// parseSimhash decodes a simhash written by formatSimhash.
+func parseSimhash(s string) (uint64, bool) {
+	hash, err := strconv.ParseUint(s, 16, 64)
+	return hash, err == nil
+}
+
+// loadPageHashes reads a -hashes-out file from an earlier run, keeping the
+// most recent record for each URL. A missing file yields no records.
+func loadPageHashes(filename string) (map[string]pageHash, error) {
+	hashes := make(map[string]pageHash)
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return hashes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err == io.EOF {
+			return hashes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var record pageHash
+		if json.Unmarshal(scanner.Bytes(), &record) == nil && record.URL != "" {
+			hashes[record.URL] = record
+		}
+	}
+	return hashes, scanner.Err()
+}
+
+// decodeBody converts body to UTF-8 using the charset from contentType or the
+// document itself, so that hashes don't depend on the encoding a page is served in.
+func decodeBody(body []byte, contentType string) []byte {
+	r, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return body
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return body
+	}
+	return decoded
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// articleText returns a few hundred words of text, with word i replaced by
+// the entries of changes.
+func articleText(changes map[int]string) string {
+	var words []string
+	for i := 0; i < 300; i++ {
+		word := fmt.Sprintf("word%d", i%50)
+		if i%7 == 0 {
+			word = fmt.Sprintf("topic%d", i)
+		}
+		if changed, ok := changes[i]; ok {
+			word = changed
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+func TestSimhashDistance(t *testing.T) {
+	page := simhash(articleText(nil))
+	tests := []struct {
+		name    string
+		text    string
+		maxDist int
+		minDist int
+	}{
+		{"identical", articleText(nil), 0, 0},
+		// Case and punctuation aren't words
+		{"case and punctuation", strings.ToUpper(strings.ReplaceAll(articleText(nil), " ", ", ")), 0, 0},
+		{"one word changed", articleText(map[int]string{150: "changed"}), 6, 0},
+		{"a few words changed", articleText(map[int]string{10: "a", 120: "b", 240: "c"}), 12, 0},
+		{"unrelated", strings.Repeat("the quick brown fox jumps over the lazy dog while ", 30) + "nothing else", 64, 16},
+	}
+	for _, tt := range tests {
+		got := hammingDistance(page, simhash(tt.text))
+		if got > tt.maxDist || got < tt.minDist {
+			t.Errorf("%s: distance = %d, want %d to %d", tt.name, got, tt.minDist, tt.maxDist)
+		}
+	}
+
+	if simhash("") != 0 || simhash(" -- ") != 0 {
+		t.Error("text without words doesn't hash to 0")
+	}
+	// Texts shorter than a shingle are hashed whole
+	if simhash("hello world") == 0 || simhash("hello world") == simhash("hello there") {
+		t.Error("short texts aren't told apart")
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xff, 0x0f, 4},
+		{0, ^uint64(0), 64},
+		{1 << 63, 1, 2},
+	}
+	for _, tt := range tests {
+		if got := hammingDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("hammingDistance(%x, %x) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFormatParseSimhash(t *testing.T) {
+	for _, hash := range []uint64{0, 1, 0xdeadbeef, 1 << 63, ^uint64(0), simhash(articleText(nil))} {
+		s := formatSimhash(hash)
+		if len(s) != 16 {
+			t.Errorf("formatSimhash(%x) = %q, want 16 digits", hash, s)
+		}
+		if got, ok := parseSimhash(s); !ok || got != hash {
+			t.Errorf("parseSimhash(%q) = %x, %v, want %x", s, got, ok, hash)
+		}
+	}
+	for _, bad := range []string{"", "zz", "0x1f", "-1", "+1f", "1f 2e", "1ffffffffffffffff"} {
+		if _, ok := parseSimhash(bad); ok {
+			t.Errorf("parseSimhash(%q) accepted", bad)
+		}
+	}
+}
+
+func TestLoadPageHashes(t *testing.T) {
+	dir := t.TempDir()
+	records := `{"url":"https://example.com/","sha256":"aa","simhash":"0000000000000001"}
+not json
+{"sha256":"no url"}
+{"url":"https://example.com/a","sha256":"bb","simhash":"00000000000000ff"}
+{"url":"https://example.com/","sha256":"cc","simhash":"0000000000000002"}
+`
+	plain := filepath.Join(dir, "hashes.jsonl")
+	if err := os.WriteFile(plain, []byte(records), 0644); err != nil {
+		t.Fatal(err)
+	}
+	compressed := filepath.Join(dir, "hashes.jsonl.gz")
+	file, err := os.Create(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	gz.Write([]byte(records))
+	gz.Close()
+	file.Close()
+
+	for _, filename := range []string{plain, compressed} {
+		hashes, err := loadPageHashes(filename)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		// The last record for a URL wins, and lines that aren't records are skipped
+		if len(hashes) != 2 || hashes["https://example.com/"].SHA256 != "cc" || hashes["https://example.com/a"].Simhash != "00000000000000ff" {
+			t.Errorf("%s: hashes = %v", filepath.Base(filename), hashes)
+		}
+	}
+
+	empty := filepath.Join(dir, "empty.jsonl.gz")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range []string{filepath.Join(dir, "missing.jsonl"), empty} {
+		if hashes, err := loadPageHashes(filename); err != nil || len(hashes) != 0 {
+			t.Errorf("%s: hashes = %v, %v, want none", filepath.Base(filename), hashes, err)
+		}
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.jsonl.gz")
+	if err := os.WriteFile(corrupt, []byte("not gzip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPageHashes(corrupt); err == nil {
+		t.Error("corrupt gzip file loaded without an error")
+	}
+}
+
+func TestNewPageHashEncoding(t *testing.T) {
+	utf8 := newPageHash("https://example.com/", decodeBody([]byte("<p>café crème</p>"), "text/html; charset=utf-8"))
+	latin1 := newPageHash("https://example.com/", decodeBody([]byte("<p>caf\xe9 cr\xe8me</p>"), "text/html; charset=iso-8859-1"))
+	if utf8 != latin1 {
+		t.Errorf("hashes differ by encoding: %+v and %+v", utf8, latin1)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// hintsVersion is bumped whenever the layout of hintsFile changes. Hints files
+// of another version are ignored, as hints are only a shortcut.
+const hintsVersion = 1
+
+// hostHint is what a run learned about a host, for -hints.
+type hostHint struct {
+	// Scheme is the scheme schemeless targets on the host answered over
+	Scheme string `json:"scheme,omitempty"`
+	// NoHTTP3 is set when the host's QUIC connection failed under -http3
+	NoHTTP3 bool `json:"no_http3,omitempty"`
+	// Updated is when a run last confirmed the hint; older hints go stale
+	Updated time.Time `json:"updated"`
+}
+
+// hintsFile is the layout of a -hints file. Hosts are keyed by hostname, or by
+// host:port for the HTTP/3 results, which the -http3 transport keeps per port.
+type hintsFile struct {
+	Version int                 `json:"version"`
+	Hosts   map[string]hostHint `json:"hosts"`
+}
+
+// loadHints reads a hints file written by saveHints, leaving out hints not
+// updated within maxAge. A missing file yields no hints.
+func loadHints(filename string, maxAge time.Duration) (map[string]hostHint, error) {
+	hints := make(map[string]hostHint)
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return hints, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file hintsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Version != hintsVersion {
+		return nil, fmt.Errorf("hints file has version %d, this getends expects version %d", file.Version, hintsVersion)
+	}
+	for host, hint := range file.Hosts {
+		if maxAge <= 0 || time.Since(hint.Updated) <= maxAge {
+			hints[host] = hint
+		}
+	}
+	return hints, nil
+}
+
+// saveHints writes hints to filename, replacing it.
+func saveHints(filename string, hints map[string]hostHint) error {
+	data, err := json.MarshalIndent(hintsFile{Version: hintsVersion, Hosts: hints}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, append(data, '\n'))
+}
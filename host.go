@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// hostKey returns the form of a host used to compare hosts and key per-host
+// state such as rate limiters, learned schemes and scope: lowercase, without
+// a port, brackets or trailing dot, and with IP addresses written the one way
+// netip writes them. "[2606:4700::ABCD]:8443" and "2606:4700:0::abcd" give the
+// same key. Zone identifiers are kept as they are, since the same link-local
+// address behind two interfaces is two hosts.
+func hostKey(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), ".")
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.String()
+	}
+	return strings.ToLower(host)
+}
+
+// parseIPHost returns the address of host when it is an IP literal, bracketed
+// or not and possibly with a zone, which net.ParseIP rejects. The zone is
+// dropped, as net.IP has no room for it.
+func parseIPHost(host string) net.IP {
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	if err != nil {
+		return nil
+	}
+	return net.IP(addr.WithZone("").AsSlice())
+}
+
+// escapeZone percent-encodes the % of an IPv6 zone in the bracketed host of
+// a URL or host:port, as in [fe80::1%eth0]:8080, which url.Parse otherwise
+// rejects as an invalid escape. Zones already written as %25 are left alone.
+func escapeZone(target string) string {
+	start := 0
+	if i := strings.Index(target, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	authority := target[start:]
+	if i := strings.IndexAny(authority, "/?#"); i >= 0 {
+		authority = authority[:i]
+	}
+	open, end := strings.Index(authority, "["), strings.Index(authority, "]")
+	if open < 0 || end < open {
+		return target
+	}
+	pct := strings.Index(authority[open:end], "%")
+	if pct < 0 || strings.HasPrefix(authority[open+pct:], "%25") {
+		return target
+	}
+	pct += start + open
+	return target[:pct] + "%25" + target[pct+1:]
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestHostKey(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"Example.COM", "example.com"},
+		{"example.com:8080", "example.com"},
+		{"EXAMPLE.com.:443", "example.com"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"192.0.2.1:80", "192.0.2.1"},
+		{"::1", "::1"},
+		{"[::1]", "::1"},
+		{"[::1]:8080", "::1"},
+		{"2606:4700::ABCD", "2606:4700::abcd"},
+		{"2606:4700:0::abcd", "2606:4700::abcd"},
+		{"[2606:4700::ABCD]", "2606:4700::abcd"},
+		{"[2606:4700:0:0::AbCd]:8443", "2606:4700::abcd"},
+		{"::FFFF:192.0.2.1", "::ffff:192.0.2.1"},
+		// Zones are part of the host, and kept as written
+		{"fe80::1%eth0", "fe80::1%eth0"},
+		{"[FE80::1%eth0]", "fe80::1%eth0"},
+		{"[fe80::1%eth0]:8080", "fe80::1%eth0"},
+		{"[fe80::1%ETH0]:8080", "fe80::1%ETH0"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := hostKey(tt.host); got != tt.want {
+			t.Errorf("hostKey(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestParseIPHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"[192.0.2.1]", "192.0.2.1"},
+		{"::1", "::1"},
+		{"[::1]", "::1"},
+		{"2606:4700::ABCD", "2606:4700::abcd"},
+		{"[2606:4700::abcd]", "2606:4700::abcd"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"[FE80::1%eth0]", "fe80::1"},
+		// Ports, names and anything else aren't IP literals
+		{"[::1]:8080", ""},
+		{"192.0.2.1:80", ""},
+		{"example.com", ""},
+		{"[example.com]", ""},
+		{"192.0.2", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := parseIPHost(tt.host)
+		switch {
+		case tt.want == "" && got != nil:
+			t.Errorf("parseIPHost(%q) = %v, want nil", tt.host, got)
+		case tt.want != "" && !got.Equal(net.ParseIP(tt.want)):
+			t.Errorf("parseIPHost(%q) = %v, want %s", tt.host, got, tt.want)
+		}
+	}
+	if got := parseIPHost("192.0.2.1"); len(got) != net.IPv4len {
+		t.Errorf("parseIPHost(192.0.2.1) has %d bytes, want %d", len(got), net.IPv4len)
+	}
+}
+
+func TestEscapeZone(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"http://[fe80::1%eth0]:8080/", "http://[fe80::1%25eth0]:8080/"},
+		{"https://[FE80::1%en0]/path?q=1", "https://[FE80::1%25en0]/path?q=1"},
+		{"[fe80::1%eth0]:8080", "[fe80::1%25eth0]:8080"},
+		{"[fe80::1%eth0]", "[fe80::1%25eth0]"},
+		// Already escaped, or nothing to escape
+		{"http://[fe80::1%25eth0]:8080/", "http://[fe80::1%25eth0]:8080/"},
+		{"http://[::1]:8080/", "http://[::1]:8080/"},
+		{"http://[2606:4700::ABCD]/", "http://[2606:4700::ABCD]/"},
+		{"http://example.com/a%20b", "http://example.com/a%20b"},
+		// Only the authority is looked at
+		{"http://[::1]/search?q=100%", "http://[::1]/search?q=100%"},
+		{"http://example.com/[fe80::1%eth0]", "http://example.com/[fe80::1%eth0]"},
+		{"http://example.com/#[fe80::1%eth0]", "http://example.com/#[fe80::1%eth0]"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := escapeZone(tt.target); got != tt.want {
+			t.Errorf("escapeZone(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+
+	// The escaped form parses, keeping the zone in the hostname
+	for _, target := range []string{"http://[fe80::1%eth0]:8080/", "http://[fe80::1%25eth0]:8080/"} {
+		parsed, err := url.Parse(escapeZone(target))
+		if err != nil {
+			t.Errorf("url.Parse(escapeZone(%q)): %v", target, err)
+			continue
+		}
+		if host, port := parsed.Hostname(), parsed.Port(); host != "fe80::1%eth0" || port != "8080" {
+			t.Errorf("escapeZone(%q) parses to host %q, port %q", target, host, port)
+		}
+		if got := hostKey(parsed.Host); got != "fe80::1%eth0" {
+			t.Errorf("hostKey(%q) = %q, want fe80::1%%eth0", parsed.Host, got)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Transport sends https requests over HTTP/3 for -http3. Hosts whose QUIC
+// connection can't be established are remembered and served by fallback from
+// then on, as are plain http requests and requests carrying a body, which
+// can't be replayed once sent.
+type http3Transport struct {
+	h3       *http3.Transport
+	fallback http.RoundTripper
+
+	mu     sync.Mutex
+	noQUIC map[string]bool
+}
+
+func newHTTP3Transport(h3 *http3.Transport, fallback http.RoundTripper) *http3Transport {
+	return &http3Transport{h3: h3, fallback: fallback, noQUIC: make(map[string]bool)}
+}
+
+// skipQUIC sends requests for host (host:port as in the URL) straight to fallback.
+func (t *http3Transport) skipQUIC(host string) {
+	t.mu.Lock()
+	t.noQUIC[strings.ToLower(host)] = true
+	t.mu.Unlock()
+}
+
+// skippedHosts returns the hosts requests are sent to fallback for.
+func (t *http3Transport) skippedHosts() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hosts := make([]string, 0, len(t.noQUIC))
+	for host := range t.noQUIC {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" || (req.Body != nil && req.Body != http.NoBody) {
+		return t.fallback.RoundTrip(req)
+	}
+	host := strings.ToLower(req.URL.Host)
+	t.mu.Lock()
+	skip := t.noQUIC[host]
+	t.mu.Unlock()
+	if skip {
+		return t.fallback.RoundTrip(req)
+	}
+
+	resp, err := t.h3.RoundTrip(req)
+	if err == nil || req.Context().Err() != nil {
+		return resp, err
+	}
+	t.mu.Lock()
+	first := !t.noQUIC[host]
+	t.noQUIC[host] = true
+	t.mu.Unlock()
+	if first {
+		fmt.Fprintln(logOutput, color.YellowString("Warning: HTTP/3 failed for"), color.YellowString(host), "- falling back to TCP:", err)
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// quicDial returns a dial function for http3.Transport that resolves hosts
+// like the TCP dialer: IP literals as they are, then the -hosts entries, then
+// resolver. With blockPrivate, private addresses are refused before dialing.
+func quicDial(hosts map[string][]string, resolver *net.Resolver, blockPrivate bool) func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		var ips []string
+		if parseIPHost(host) != nil {
+			ips = []string{host}
+		} else if entries, ok := hosts[hostKey(host)]; ok {
+			ips = entries
+		} else if ips, err = resolver.LookupHost(ctx, host); err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			if blockPrivate && isPrivateIP(net.ParseIP(strings.SplitN(ip, "%", 2)[0])) {
+				lastErr = fmt.Errorf("connection to private address %s blocked", ip)
+				continue
+			}
+			conn, err := quic.DialAddrEarly(ctx, net.JoinHostPort(ip, port), tlsCfg, cfg)
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
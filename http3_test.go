@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// TestHTTP3Fallback checks that https requests to a server without QUIC are
+// answered over TCP, with the protocol the server negotiated, and that the
+// host is then sent straight to the fallback.
+func TestHTTP3Fallback(t *testing.T) {
+	tests := []struct {
+		name  string
+		http2 bool
+		proto string
+	}{
+		{"http1", false, "HTTP/1.1"},
+		{"http2", true, "HTTP/2.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, r.Proto)
+			}))
+			srv.EnableHTTP2 = tt.http2
+			srv.StartTLS()
+			defer srv.Close()
+
+			h3 := newHTTP3Transport(&http3.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				QUICConfig:      &quic.Config{HandshakeIdleTimeout: time.Second},
+				Dial:            quicDial(nil, net.DefaultResolver, false),
+			}, srv.Client().Transport)
+			defer captureLog(t)()
+			client := &http.Client{Transport: h3, Timeout: 10 * time.Second}
+
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get(srv.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.Proto != tt.proto || string(body) != tt.proto {
+					t.Errorf("request %d: got %s (server saw %s), want %s", i, resp.Proto, body, tt.proto)
+				}
+			}
+			if hosts := h3.skippedHosts(); len(hosts) != 1 || hosts[0] != srv.Listener.Addr().String() {
+				t.Errorf("skipped hosts = %q, want [%s]", hosts, srv.Listener.Addr())
+			}
+		})
+	}
+}
+
+// captureLog sends logOutput to the test log until the returned function is called.
+func captureLog(t *testing.T) func() {
+	saved := logOutput
+	logOutput = testWriter{t}
+	return func() { logOutput = saved }
+}
+
+// testWriter writes to a test's log.
+type testWriter struct{ t *testing.T }
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(string(p))
+	return len(p), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxConfigBlob is the size of the largest config blob that is decoded;
+	// larger ones are only scanned for string literals, up to this size
+	maxConfigBlob = 2 << 20
+	// maxConfigDepth is how deeply nested decoded config values are walked
+	maxConfigDepth = 32
+)
+
+var (
+	// configAssignment matches the start of a bootstrap config assignment such as
+	// window.__CONFIG__ = {, window["appConfig"] = { or __INITIAL_STATE__ = {,
+	// or of one built by a function, as in Nuxt 2's window.__NUXT__=(function(a){
+	configAssignment = regexp.MustCompile(`(?:window\s*(?:\.\s*[A-Za-z_$][\w$]*|\[\s*["'][^"']+["']\s*\])|\b__[A-Z][A-Z0-9_]*__)\s*=\s*(?:\{|\(\s*function\b)`)
+	// bareKey matches unquoted object keys, which JSON doesn't allow
+	bareKey = regexp.MustCompile(`([{,]\s*)([A-Za-z_$][\w$]*)\s*:`)
+	// stringLiteral matches a double-quoted string, escapes included
+	stringLiteral = regexp.MustCompile(`"(?:[^"\\\n]|\\.)*"`)
+)
+
+// extractConfigURLs finds inline config objects assigned in a script body and
+// returns the URL-valued strings inside them: absolute http(s) and ws(s) URLs,
+// protocol-relative URLs and root-relative paths.
+func extractConfigURLs(script string) []string {
+	var urls []string
+	for _, loc := range configAssignment.FindAllStringIndex(script, -1) {
+		start := strings.LastIndexAny(script[:loc[1]], "{(")
+		object, ok := balancedObject(script[start:])
+		if !ok {
+			// Cut short, most likely by -max-body; what is there is still worth a scan
+			object = script[start:]
+		}
+		if len(object) > maxConfigBlob || script[start] == '(' {
+			// Code that builds the config can't be decoded, only scanned
+			urls = scanConfigStrings(urls, object)
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(object), &value); err != nil {
+			// Object literals often leave keys unquoted; retry with them quoted
+			if err := json.Unmarshal([]byte(bareKey.ReplaceAllString(object, `$1"$2":`)), &value); err != nil {
+				urls = scanConfigStrings(urls, object)
+				continue
+			}
+		}
+		urls = appendConfigURLs(urls, value, 0)
+	}
+	return urls
+}
+
+// isJSONScript reports whether a <script> type holds JSON data rather than
+// code, as with Next.js' <script id="__NEXT_DATA__" type="application/json">,
+// Nuxt 3's __NUXT_DATA__, structured data and import maps.
+func isJSONScript(scriptType string) bool {
+	if strings.EqualFold(strings.TrimSpace(scriptType), "importmap") {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(scriptType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// extractJSONScriptURLs returns the URL-valued strings in the body of a JSON
+// <script>. Bodies that don't decode, or are too large to, are scanned for
+// string literals instead.
+func extractJSONScriptURLs(body string) []string {
+	if len(body) > maxConfigBlob {
+		return scanConfigStrings(nil, body)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		return scanConfigStrings(nil, body)
+	}
+	return appendConfigURLs(nil, value, 0)
+}
+
+// scanConfigStrings appends the URL-valued double-quoted string literals in
+// the first maxConfigBlob bytes of s, with their escapes decoded, since
+// serializers such as Nuxt's write every / as \u002F.
+func scanConfigStrings(urls []string, s string) []string {
+	if len(s) > maxConfigBlob {
+		s = s[:maxConfigBlob]
+	}
+	for _, literal := range stringLiteral.FindAllString(s, -1) {
+		var value string
+		if err := json.Unmarshal([]byte(literal), &value); err == nil && isConfigURL(value) {
+			urls = append(urls, value)
+		}
+	}
+	return urls
+}
+
+// balancedObject returns the object literal or parenthesized expression at
+// the start of s, up to the brace or parenthesis closing its first one,
+// skipping those inside strings.
+func balancedObject(s string) (string, bool) {
+	open, closing := s[0], byte('}')
+	if open == '(' {
+		closing = ')'
+	}
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == open:
+			depth++
+		case c == closing:
+			depth--
+			if depth == 0 {
+				return s[:i+1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// appendConfigURLs walks a decoded JSON value and appends every URL-valued
+// string, going no deeper than maxConfigDepth levels below depth.
+func appendConfigURLs(urls []string, value interface{}, depth int) []string {
+	if depth > maxConfigDepth {
+		return urls
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			urls = appendConfigURLs(urls, v[key], depth+1)
+		}
+	case []interface{}:
+		for _, child := range v {
+			urls = appendConfigURLs(urls, child, depth+1)
+		}
+	case string:
+		if isConfigURL(v) {
+			urls = append(urls, v)
+		}
+	}
+	return urls
+}
+
+// isConfigURL reports whether a config string value looks like a URL or path.
+func isConfigURL(s string) bool {
+	if strings.ContainsAny(s, " \t\r\n<>") {
+		return false
+	}
+	for _, prefix := range []string{"http://", "https://", "ws://", "wss://"} {
+		if strings.HasPrefix(strings.ToLower(s), prefix) {
+			return len(s) > len(prefix)
+		}
+	}
+	return len(s) > 1 && strings.HasPrefix(s, "/")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []string
+	}{
+		{"nextjs.html", []string{
+			"https://cdn.example.com", "/products/[id]", "https://api.example.com/v2", "/_next/static/media/hero.jpg",
+			"/products/42", "/products/43", "https://o1.ingest.sentry.io/api/1/", "wss://rt.example.com/live",
+			"/vendor/lodash.js",
+		}},
+		{"nuxt.html", []string{
+			// Nuxt 2 builds its state in a function, so its strings are scanned
+			"/api/posts/7", "/auth/login", "https://api.example.com/nuxt2", "//cdn.example.com/",
+			// Nuxt 3 serializes it as JSON
+			"/api/nuxt3/posts", "https://api.example.com/nuxt3",
+		}},
+		{"window-config.html", []string{"https://api.example.com/v1", "/upload?x=1&y=2", "/graphql", "/logout"}},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, extract := range extractors {
+			pg := extract(strings.NewReader(string(data)), "https://example.com/")
+			if strings.Join(pg.configURLs, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("%s, %s: config URLs = %q, want %q", tt.fixture, name, pg.configURLs, tt.want)
+			}
+			for _, u := range tt.want {
+				if !containsString(pg.links, u) {
+					t.Errorf("%s, %s: links don't include %q", tt.fixture, name, u)
+				}
+			}
+		}
+	}
+}
+
+func TestIsJSONScript(t *testing.T) {
+	tests := []struct {
+		scriptType string
+		want       bool
+	}{
+		{"application/json", true},
+		{"Application/JSON; charset=utf-8", true},
+		{"application/ld+json", true},
+		{"importmap", true},
+		{" ImportMap ", true},
+		{"text/javascript", false},
+		{"module", false},
+		{"", false},
+		{"application/jsonp", false},
+	}
+	for _, tt := range tests {
+		if got := isJSONScript(tt.scriptType); got != tt.want {
+			t.Errorf("isJSONScript(%q) = %v, want %v", tt.scriptType, got, tt.want)
+		}
+	}
+}
+
+func TestExtractConfigURLsLimits(t *testing.T) {
+	// Values nested deeper than maxConfigDepth aren't walked
+	deep := strings.Repeat(`{"a":`, maxConfigDepth+2) + `"/too-deep"` + strings.Repeat("}", maxConfigDepth+2)
+	shallow := strings.Repeat(`{"a":`, maxConfigDepth) + `"/deep-enough"` + strings.Repeat("}", maxConfigDepth)
+	if got := extractConfigURLs("window.__CONFIG__ = " + deep + ";"); len(got) != 0 {
+		t.Errorf("too deep: got %q, want nothing", got)
+	}
+	if got := extractConfigURLs("window.__CONFIG__ = " + shallow + ";"); len(got) != 1 || got[0] != "/deep-enough" {
+		t.Errorf("deep enough: got %q, want [/deep-enough]", got)
+	}
+
+	// A blob over maxConfigBlob is only scanned, and only up to the cap
+	padding := strings.Repeat(" ", maxConfigBlob)
+	huge := `{"first": "/first",` + padding + `"last": "/last"}`
+	if got := extractJSONScriptURLs(huge); len(got) != 1 || got[0] != "/first" {
+		t.Errorf("huge blob: got %q, want [/first]", got)
+	}
+
+	// An object cut short by -max-body is still scanned
+	if got := extractConfigURLs(`window.__INITIAL_STATE__ = {"api": "/api", "more": {"x": "/cut`); len(got) != 1 || got[0] != "/api" {
+		t.Errorf("truncated: got %q, want [/api]", got)
+	}
+}
+
+// TestConfigTag checks that config URLs are recorded with the config tag.
+func TestConfigTag(t *testing.T) {
+	data, err := os.ReadFile("testdata/window-config.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := serveSite(t, map[string]string{"/": string(data)})
+	export := filepath.Join(t.TempDir(), "export.json")
+	runGetends(t, "-u", srv.URL+"/", "-export-state", export)
+
+	raw, err := os.ReadFile(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state exportedState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		t.Fatal(err)
+	}
+	tags := make(map[string]string)
+	for _, u := range state.Extracted {
+		tags[u.URL] = u.Tag
+	}
+	for _, path := range []string{"/upload?x=1&y=2", "/graphql", "/logout"} {
+		if tag := tags[srv.URL+path]; tag != "config" {
+			t.Errorf("%s tagged %q, want config", path, tag)
+		}
+	}
+}
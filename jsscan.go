@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fatih/color"
+)
+
+// jsEndpoint matches quoted strings in a script that look like absolute URLs
+// or root-relative paths, e.g. "/api/v1/users" or 'https://api.example.com/'.
+var jsEndpoint = regexp.MustCompile("[\"'`]((?:https?:)?//[^\"'`\\s<>{}]+|/[A-Za-z0-9_\\-][A-Za-z0-9_\\-./~%?=&:@+,;]*)[\"'`]")
+
+// extractJSEndpoints returns the URLs and paths quoted in a script, in order
+// of appearance and without duplicates.
+func extractJSEndpoints(js string) []string {
+	seen := make(map[string]struct{})
+	var endpoints []string
+	for _, m := range jsEndpoint.FindAllStringSubmatch(js, -1) {
+		endpoint := m[1]
+		// Comment openers and bare protocol-relative prefixes aren't endpoints
+		if strings.HasPrefix(endpoint, "/*") || endpoint == "//" {
+			continue
+		}
+		if _, dup := seen[endpoint]; dup {
+			continue
+		}
+		seen[endpoint] = struct{}{}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// jsJob is a script waiting to be scanned with -scan-js.
+type jsJob struct {
+	url string
+	// target is the target whose page linked the script
+	target string
+	// scope is the hostname endpoints must be in scope of
+	scope string
+}
+
+// jsQueue is an unbounded FIFO of scripts waiting to be scanned. Adding never
+// blocks, so the page workers can queue scripts while holding the results lock
+// that the script workers also need.
+type jsQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	jobs   []jsJob
+	closed bool
+}
+
+func newJSQueue() *jsQueue {
+	q := &jsQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// add queues job. Jobs added after close are dropped.
+func (q *jsQueue) add(job jsJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.jobs = append(q.jobs, job)
+	q.cond.Signal()
+}
+
+// close marks the end of the jobs; next keeps returning the queued ones until none are left.
+func (q *jsQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// next waits for a job, returning false once the queue is closed and empty.
+func (q *jsQueue) next() (jsJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.jobs) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.jobs) == 0 {
+		return jsJob{}, false
+	}
+	job := q.jobs[0]
+	q.jobs = q.jobs[1:]
+	return job, true
+}
+
+// jsPool is the set of workers scanning the scripts in a jsQueue alongside
+// the page workers.
+type jsPool struct {
+	wg sync.WaitGroup
+	// scanned and endpoints count the scripts scanned and the new endpoints
+	// they held; skipped counts the scripts left once ctx was done
+	scanned, endpoints, skipped int64
+}
+
+// startJSPool starts workers goroutines passing the jobs in q to scan until q
+// is closed and empty. Once ctx is done the rest of the queue is only
+// drained, so that wait returns promptly.
+func startJSPool(ctx context.Context, q *jsQueue, workers int, scan func(context.Context, jsJob) (int, error)) *jsPool {
+	p := &jsPool{}
+	for w := 0; w < workers; w++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				job, ok := q.next()
+				if !ok {
+					return
+				}
+				if ctx.Err() != nil {
+					atomic.AddInt64(&p.skipped, 1)
+					continue
+				}
+				found, err := scan(ctx, job)
+				if err != nil {
+					if ctx.Err() != nil {
+						atomic.AddInt64(&p.skipped, 1)
+					} else {
+						fmt.Fprintln(logOutput, color.YellowString("Warning: Skipping script"), color.YellowString(job.url), "-", err)
+					}
+					continue
+				}
+				atomic.AddInt64(&p.scanned, 1)
+				atomic.AddInt64(&p.endpoints, int64(found))
+			}
+		}()
+	}
+	return p
+}
+
+// wait waits for the workers to finish; the queue must have been closed.
+func (p *jsPool) wait() {
+	p.wg.Wait()
+}
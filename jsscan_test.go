@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExtractJSEndpoints(t *testing.T) {
+	js := `fetch("/api/v1/users");
+const base = 'https://api.example.com/';
+const again = "/api/v1/users";
+/* "/*not" */ const proto = "//";
+const tpl = ` + "`/graphql?op=list`" + `;
+const word = "hello";`
+	want := []string{"/api/v1/users", "https://api.example.com/", "/graphql?op=list"}
+	if got := extractJSEndpoints(js); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("extractJSEndpoints = %q, want %q", got, want)
+	}
+}
+
+func TestJSQueue(t *testing.T) {
+	q := newJSQueue()
+	q.add(jsJob{url: "a"})
+	q.add(jsJob{url: "b"})
+	q.close()
+	q.add(jsJob{url: "c"})
+	for _, want := range []string{"a", "b"} {
+		if job, ok := q.next(); !ok || job.url != want {
+			t.Fatalf("next = %q, %v, want %q", job.url, ok, want)
+		}
+	}
+	if job, ok := q.next(); ok {
+		t.Errorf("next after close = %q, want nothing", job.url)
+	}
+}
+
+// TestJSPool feeds the pool from several producers while it runs, the way the
+// page workers do, with every script recording into one shared set. Run it
+// with -race.
+func TestJSPool(t *testing.T) {
+	const producers, perProducer, distinct = 8, 50, 30
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]struct{})
+	)
+	scan := func(ctx context.Context, job jsJob) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		found := 0
+		for _, endpoint := range extractJSEndpoints(job.url) {
+			if _, dup := seen[endpoint]; !dup {
+				seen[endpoint] = struct{}{}
+				found++
+			}
+		}
+		return found, nil
+	}
+
+	q := newJSQueue()
+	pool := startJSPool(context.Background(), q, 4, scan)
+	var producing sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		producing.Add(1)
+		go func(p int) {
+			defer producing.Done()
+			for i := 0; i < perProducer; i++ {
+				q.add(jsJob{url: fmt.Sprintf(`"/api/%d"`, (p*perProducer+i)%distinct)})
+			}
+		}(p)
+	}
+	producing.Wait()
+	q.close()
+	pool.wait()
+
+	if pool.scanned != producers*perProducer || pool.endpoints != distinct || pool.skipped != 0 {
+		t.Errorf("scanned %d, found %d, skipped %d, want %d, %d, 0", pool.scanned, pool.endpoints, pool.skipped, producers*perProducer, distinct)
+	}
+	if len(seen) != distinct {
+		t.Errorf("recorded %d endpoints, want %d", len(seen), distinct)
+	}
+}
+
+// TestJSPoolCancel checks that cancelling the context, as an interrupt or an
+// exhausted -js-budget does, stops the scans in flight and skips the rest of
+// the queue instead of hanging.
+func TestJSPoolCancel(t *testing.T) {
+	const jobs = 100
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{}, jobs)
+	scan := func(ctx context.Context, job jsJob) (int, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+
+	q := newJSQueue()
+	for i := 0; i < jobs; i++ {
+		q.add(jsJob{url: fmt.Sprint(i)})
+	}
+	pool := startJSPool(ctx, q, 4, scan)
+	<-started
+	cancel()
+	q.close()
+
+	done := make(chan struct{})
+	go func() {
+		pool.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pool didn't stop after cancel")
+	}
+	if pool.scanned != 0 || pool.skipped != jobs {
+		t.Errorf("scanned %d, skipped %d, want 0, %d", pool.scanned, pool.skipped, jobs)
+	}
+}
+
+// TestScanJS crawls several pages sharing scripts with the page and script
+// workers running at once. Run it with -race.
+func TestScanJS(t *testing.T) {
+	pages := map[string]string{}
+	for i := 0; i < 6; i++ {
+		pages[fmt.Sprintf("/js/%d.js", i)] = fmt.Sprintf(`fetch("/api/shared"); fetch("/api/%d"); fetch("https://elsewhere.example.net/x");`, i)
+	}
+	for _, p := range []string{"/a", "/b", "/c"} {
+		var body strings.Builder
+		for i := 0; i < 6; i++ {
+			fmt.Fprintf(&body, `<script src="/js/%d.js"></script>`, i)
+		}
+		pages[p] = body.String()
+	}
+	srv := serveSite(t, pages)
+	list := filepath.Join(t.TempDir(), "targets.txt")
+	if err := os.WriteFile(list, []byte(srv.URL+"/a\n"+srv.URL+"/b\n"+srv.URL+"/c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := runGetends(t, "-l", list, "-c", "3", "-scan-js", "-js-concurrency", "4")
+	// The scripts themselves are junk, but still scanned
+	want := []string{srv.URL + "/api/shared"}
+	for i := 0; i < 6; i++ {
+		want = append(want, fmt.Sprintf("%s/api/%d", srv.URL, i))
+	}
+	if !sameURLs(got, want) {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
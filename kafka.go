@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/IBM/sarama"
+	"github.com/fatih/color"
+)
+
+// kafkaQueueSize is how many messages may wait to be sent; URLs found while
+// the queue is full are dropped rather than holding up the crawl
+const kafkaQueueSize = 10000
+
+// kafkaSink produces extracted URLs to a Kafka topic as they are found. Messages
+// are sent in the background, so a slow or unreachable broker never blocks the
+// workers.
+type kafkaSink struct {
+	producer sarama.AsyncProducer
+	topic    string
+	// failed counts messages the brokers didn't accept, or that were dropped
+	// from a full queue
+	failed int64
+	done   chan struct{}
+}
+
+// newKafkaSink connects to the comma-separated brokers and starts a producer for topic.
+func newKafkaSink(brokers, topic string) (*kafkaSink, error) {
+	config := sarama.NewConfig()
+	config.ClientID = "getends"
+	config.Producer.RequiredAcks = sarama.WaitForLocal
+	config.Producer.Retry.Max = 3
+	config.Producer.Return.Errors = true
+	config.ChannelBufferSize = kafkaQueueSize
+
+	var addrs []string
+	for _, broker := range strings.Split(brokers, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			addrs = append(addrs, broker)
+		}
+	}
+	producer, err := sarama.NewAsyncProducer(addrs, config)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &kafkaSink{producer: producer, topic: topic, done: make(chan struct{})}
+	go func() {
+		defer close(k.done)
+		for err := range producer.Errors() {
+			k.fail(err.Err)
+		}
+	}()
+	return k, nil
+}
+
+// fail counts a message that wasn't sent, warning about the first.
+func (k *kafkaSink) fail(err error) {
+	if atomic.AddInt64(&k.failed, 1) == 1 {
+		fmt.Fprintln(logOutput, color.YellowString("Warning: Could not produce to Kafka:"), err)
+	}
+}
+
+// produce queues result for sending, dropping it when the queue is full. It
+// never waits, so it is safe to call with locks held. A nil sink does nothing.
+func (k *kafkaSink) produce(result urlResult) {
+	if k == nil {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	msg := &sarama.ProducerMessage{
+		Topic: k.topic,
+		Key:   sarama.StringEncoder(result.Target),
+		Value: sarama.ByteEncoder(data),
+	}
+	select {
+	case k.producer.Input() <- msg:
+	default:
+		k.fail(fmt.Errorf("queue of %d messages full", kafkaQueueSize))
+	}
+}
+
+// Close flushes the queued messages and returns how many of all those
+// produced were rejected. A nil sink does nothing.
+func (k *kafkaSink) Close() int64 {
+	if k == nil {
+		return 0
+	}
+	k.producer.AsyncClose()
+	<-k.done
+	return atomic.LoadInt64(&k.failed)
+}
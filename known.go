@@ -0,0 +1,68 @@
+package main
+
+import "strings"
+
+// priorRuns holds the URLs found by earlier runs, from -known and a resumed
+// -state, so that this run can tell them apart from the URLs it is the first
+// to find. Both are counted per target for the INFO line.
+type priorRuns struct {
+	urls map[string]struct{}
+	// reported holds the prior URLs this run has found again
+	reported    map[string]struct{}
+	newCounts   map[string]int
+	knownCounts map[string]int
+}
+
+func newPriorRuns() *priorRuns {
+	return &priorRuns{
+		urls:        make(map[string]struct{}),
+		reported:    make(map[string]struct{}),
+		newCounts:   make(map[string]int),
+		knownCounts: make(map[string]int),
+	}
+}
+
+// add marks u as found by an earlier run.
+func (p *priorRuns) add(u string) {
+	p.urls[u] = struct{}{}
+}
+
+// addOutputLine adds the URL on a line of an earlier output file, which may
+// be led by a count (-count-output) or a class (-classify).
+func (p *priorRuns) addOutputLine(line string) {
+	if fields := strings.Fields(line); len(fields) > 0 {
+		p.add(fields[len(fields)-1])
+	}
+}
+
+// found counts u, which this run has just found for the first time, towards
+// target and reports whether an earlier run had found it.
+func (p *priorRuns) found(u, target string) bool {
+	if _, old := p.urls[u]; old {
+		p.reported[u] = struct{}{}
+		p.knownCounts[target]++
+		return true
+	}
+	p.newCounts[target]++
+	return false
+}
+
+// refound handles u being found again when it is already stored, as URLs
+// restored from -state are. It reports whether u is a prior URL this run
+// hadn't found yet, counting it towards target if so.
+func (p *priorRuns) refound(u, target string) bool {
+	if _, old := p.urls[u]; !old {
+		return false
+	}
+	if _, done := p.reported[u]; done {
+		return false
+	}
+	p.reported[u] = struct{}{}
+	p.knownCounts[target]++
+	return true
+}
+
+// counts returns how many of target's URLs were new and how many known.
+func (p *priorRuns) counts(target string) (int, int) {
+	return p.newCounts[target], p.knownCounts[target]
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPriorRuns(t *testing.T) {
+	p := newPriorRuns()
+	p.addOutputLine("https://example.com/old")
+	p.addOutputLine("3\thttps://example.com/counted")
+	p.addOutputLine("api\thttps://example.com/classified")
+	p.addOutputLine("   ")
+	p.add("https://example.com/restored")
+
+	// First finds in this run
+	if p.found("https://example.com/old", "a") != true {
+		t.Error("found(old) = false, want true")
+	}
+	if p.found("https://example.com/counted", "a") != true || p.found("https://example.com/classified", "b") != true {
+		t.Error("URLs from prefixed output lines aren't known")
+	}
+	if p.found("https://example.com/fresh", "a") != false {
+		t.Error("found(fresh) = true, want false")
+	}
+
+	// Finds of URLs already stored: only prior URLs not yet reported count
+	tests := []struct {
+		u      string
+		target string
+		want   bool
+	}{
+		{"https://example.com/restored", "b", true},
+		{"https://example.com/restored", "b", false},
+		{"https://example.com/old", "b", false},
+		{"https://example.com/fresh", "b", false},
+	}
+	for _, tt := range tests {
+		if got := p.refound(tt.u, tt.target); got != tt.want {
+			t.Errorf("refound(%q) = %v, want %v", tt.u, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		target         string
+		newURLs, known int
+	}{{"a", 1, 2}, {"b", 0, 2}, {"c", 0, 0}} {
+		if newURLs, known := p.counts(tt.target); newURLs != tt.newURLs || known != tt.known {
+			t.Errorf("counts(%q) = %d, %d, want %d, %d", tt.target, newURLs, known, tt.newURLs, tt.known)
+		}
+	}
+}
+
+func TestKnownConsole(t *testing.T) {
+	srv := serveSite(t, map[string]string{
+		"/": `<a href="/old">old</a><a href="/new">new</a><a href="/old">again</a>`,
+	})
+	known := filepath.Join(t.TempDir(), "known.txt")
+	if err := os.WriteFile(known, []byte(srv.URL+"/old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, showKnown := range []bool{false, true} {
+		args := []string{"-u", srv.URL + "/", "-known", known}
+		if showKnown {
+			args = append(args, "-show-known")
+		}
+		urls, log := runGetendsLog(t, args...)
+		// The output file is unaffected: it holds everything found
+		if want := []string{srv.URL + "/new", srv.URL + "/old"}; !sameURLs(urls, want) {
+			t.Errorf("-show-known=%v: output = %q, want %q", showKnown, urls, want)
+		}
+		if !strings.Contains(log, "[NEW] "+srv.URL+"/new") || strings.Contains(log, "[NEW] "+srv.URL+"/old") {
+			t.Errorf("-show-known=%v: [NEW] lines wrong in\n%s", showKnown, log)
+		}
+		if got := strings.Count(log, "[KNOWN] "+srv.URL+"/old"); (showKnown && got != 1) || (!showKnown && got != 0) {
+			t.Errorf("-show-known=%v: %d [KNOWN] lines for /old in\n%s", showKnown, got, log)
+		}
+		if !strings.Contains(log, "1 new and 1 known URLs from "+srv.URL+"/") {
+			t.Errorf("-show-known=%v: no INFO line counting 1 new and 1 known in\n%s", showKnown, log)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// languageKey is the context key of the Accept-Language a page fetch sends.
+type languageKey struct{}
+
+// withLanguage returns ctx with the Accept-Language for fetches made with it
+// set to language, which -probe-locales varies per fetch of the same target.
+func withLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, languageKey{}, language)
+}
+
+// languageFrom returns the Accept-Language set with withLanguage, if any.
+func languageFrom(ctx context.Context) string {
+	language, _ := ctx.Value(languageKey{}).(string)
+	return language
+}
+
+// parseLocales splits a comma-separated -probe-locales list, dropping
+// blanks and repeats.
+func parseLocales(list string) []string {
+	var locales []string
+	for _, locale := range strings.Split(list, ",") {
+		if locale = strings.TrimSpace(locale); locale != "" {
+			locales = appendUnique(locales, locale)
+		}
+	}
+	return locales
+}
@@ -0,0 +1,18 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile reports that output locking isn't available on this platform.
+func lockFile(file *os.File) error {
+	return errors.New("output file locking is not supported on this platform")
+}
+
+// unlockFile is a no-op on platforms without output locking.
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// failureClasses are the label values of getends_fetch_failures_total, in output order.
+var failureClasses = []string{"dns", "connect", "tls", "http", "slow_body", "other"}
+
+// crawlMetrics holds the counters and histograms served on -metrics-addr in
+// the Prometheus text format. Workers update them with atomic operations
+// only, so recording never waits on a lock. A nil crawlMetrics records nothing.
+type crawlMetrics struct {
+	targets   int64
+	extracted int64
+	failures  []int64
+	duration  *histogram
+	bodySize  *histogram
+}
+
+func newCrawlMetrics() *crawlMetrics {
+	return &crawlMetrics{
+		failures: make([]int64, len(failureClasses)),
+		duration: newHistogram([]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}),
+		bodySize: newHistogram([]float64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 5 << 20, 10 << 20}),
+	}
+}
+
+// targetDone counts a processed target.
+func (m *crawlMetrics) targetDone() {
+	if m != nil {
+		atomic.AddInt64(&m.targets, 1)
+	}
+}
+
+// urlExtracted counts a newly extracted URL.
+func (m *crawlMetrics) urlExtracted() {
+	if m != nil {
+		atomic.AddInt64(&m.extracted, 1)
+	}
+}
+
+// fetchFailed counts a target whose fetch failed with err, or was answered with resp.
+func (m *crawlMetrics) fetchFailed(err error, resp *http.Response) {
+	if m == nil {
+		return
+	}
+	label := failureLabel(err, resp)
+	for i, class := range failureClasses {
+		if class == label {
+			atomic.AddInt64(&m.failures[i], 1)
+		}
+	}
+}
+
+// requestDone records how long a request took to get its response headers.
+func (m *crawlMetrics) requestDone(d time.Duration) {
+	if m != nil {
+		m.duration.observe(d.Seconds())
+	}
+}
+
+// bodyRead records the size of a target's body as read.
+func (m *crawlMetrics) bodyRead(n int64) {
+	if m != nil {
+		m.bodySize.observe(float64(n))
+	}
+}
+
+// failureLabel names the class of a failed fetch. Unlike classifyFetch,
+// which only separates what is worth retrying, it also gives permanent
+// failures such as nonexistent names and bad certificates their class.
+func failureLabel(err error, resp *http.Response) string {
+	if errors.Is(err, errSlowBody) {
+		return "slow_body"
+	}
+	if class := classifyFetch(err, resp); class != classNone {
+		return class.String()
+	}
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		return "http"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case isTLSError(err):
+		return "tls"
+	}
+	return "other"
+}
+
+// write renders the metrics in the Prometheus text exposition format.
+func (m *crawlMetrics) write(w io.Writer) {
+	fmt.Fprintln(w, "# HELP getends_targets_processed_total Targets processed, whether or not the fetch succeeded.")
+	fmt.Fprintln(w, "# TYPE getends_targets_processed_total counter")
+	fmt.Fprintf(w, "getends_targets_processed_total %d\n", atomic.LoadInt64(&m.targets))
+	fmt.Fprintln(w, "# HELP getends_fetch_failures_total Targets that failed, by class of failure.")
+	fmt.Fprintln(w, "# TYPE getends_fetch_failures_total counter")
+	for i, class := range failureClasses {
+		fmt.Fprintf(w, "getends_fetch_failures_total{class=%q} %d\n", class, atomic.LoadInt64(&m.failures[i]))
+	}
+	fmt.Fprintln(w, "# HELP getends_urls_extracted_total Unique URLs extracted.")
+	fmt.Fprintln(w, "# TYPE getends_urls_extracted_total counter")
+	fmt.Fprintf(w, "getends_urls_extracted_total %d\n", atomic.LoadInt64(&m.extracted))
+	m.duration.write(w, "getends_request_duration_seconds", "Time from sending a request to receiving its response headers.")
+	m.bodySize.write(w, "getends_body_size_bytes", "Bytes of each target's body read for extraction.")
+}
+
+// ServeHTTP serves the metrics for /metrics.
+func (m *crawlMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// histogram is a Prometheus histogram updated with atomic operations.
+type histogram struct {
+	bounds []float64
+	// counts holds one count per bound plus the +Inf bucket; they aren't
+	// cumulative until written
+	counts []uint64
+	count  uint64
+	// sum holds the float64 bits of the sum of the observations
+	sum uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	for {
+		old := atomic.LoadUint64(&h.sum)
+		if atomic.CompareAndSwapUint64(&h.sum, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'f', -1, 64), cumulative)
+	}
+	cumulative += atomic.LoadUint64(&h.counts[len(h.bounds)])
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, cumulative)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(math.Float64frombits(atomic.LoadUint64(&h.sum)), 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, atomic.LoadUint64(&h.count))
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
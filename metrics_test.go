@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMetricsEndpoint records known events and checks the lines scraped from /metrics.
+func TestMetricsEndpoint(t *testing.T) {
+	m := newCrawlMetrics()
+	for i := 0; i < 3; i++ {
+		m.targetDone()
+	}
+	for i := 0; i < 5; i++ {
+		m.urlExtracted()
+	}
+	m.fetchFailed(fetchErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "nope.example.com", IsNotFound: true}}), nil)
+	m.fetchFailed(fetchErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), nil)
+	m.fetchFailed(fetchErr(x509.UnknownAuthorityError{}), nil)
+	m.fetchFailed(nil, status(503, ""))
+	m.fetchFailed(nil, status(404, ""))
+	m.fetchFailed(errSlowBody, nil)
+	m.fetchFailed(fetchErr(errors.New("boom")), nil)
+	// Durations and sizes exact in binary, so the sums print exactly
+	m.requestDone(31250 * time.Microsecond)
+	m.requestDone(750 * time.Millisecond)
+	m.requestDone(45 * time.Second)
+	m.bodyRead(512)
+	m.bodyRead(2048)
+	m.bodyRead(20 << 20)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(body), "\n")
+
+	for _, want := range []string{
+		"# TYPE getends_targets_processed_total counter",
+		"getends_targets_processed_total 3",
+		"getends_urls_extracted_total 5",
+		"# TYPE getends_fetch_failures_total counter",
+		`getends_fetch_failures_total{class="dns"} 1`,
+		`getends_fetch_failures_total{class="connect"} 1`,
+		`getends_fetch_failures_total{class="tls"} 1`,
+		`getends_fetch_failures_total{class="http"} 2`,
+		`getends_fetch_failures_total{class="slow_body"} 1`,
+		`getends_fetch_failures_total{class="other"} 1`,
+		"# TYPE getends_request_duration_seconds histogram",
+		`getends_request_duration_seconds_bucket{le="0.05"} 1`,
+		`getends_request_duration_seconds_bucket{le="0.5"} 1`,
+		`getends_request_duration_seconds_bucket{le="1"} 2`,
+		`getends_request_duration_seconds_bucket{le="30"} 2`,
+		`getends_request_duration_seconds_bucket{le="+Inf"} 3`,
+		"getends_request_duration_seconds_sum 45.78125",
+		"getends_request_duration_seconds_count 3",
+		"# TYPE getends_body_size_bytes histogram",
+		`getends_body_size_bytes_bucket{le="1024"} 1`,
+		`getends_body_size_bytes_bucket{le="10240"} 2`,
+		`getends_body_size_bytes_bucket{le="10485760"} 2`,
+		`getends_body_size_bytes_bucket{le="+Inf"} 3`,
+		"getends_body_size_bytes_sum 2.097408e+07",
+		"getends_body_size_bytes_count 3",
+	} {
+		if !containsString(lines, want) {
+			t.Errorf("/metrics has no line %q", want)
+		}
+	}
+
+	// Buckets are cumulative, so each is at least the one before
+	prev := 0
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "getends_request_duration_seconds_bucket") {
+			continue
+		}
+		value, err := strconv.Atoi(line[strings.LastIndex(line, " ")+1:])
+		if err != nil || value < prev {
+			t.Errorf("bucket %q is below the one before (%d)", line, prev)
+		}
+		prev = value
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *crawlMetrics
+	m.targetDone()
+	m.urlExtracted()
+	m.fetchFailed(errors.New("boom"), nil)
+	m.requestDone(time.Second)
+	m.bodyRead(1)
+}
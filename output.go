@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// urlResult describes an extracted URL for the outputs that stream results
+// as they are found (-kafka, -es).
+type urlResult struct {
+	URL string `json:"url"`
+	// Source is the page, PDF or stylesheet the URL was found in
+	Source string `json:"source"`
+	// Target is the target being processed when the URL was found
+	Target string `json:"target"`
+	Tag    string `json:"tag,omitempty"`
+	Class  string `json:"class,omitempty"`
+	// Params are the names of the fields of the forms submitting to the URL
+	Params []string `json:"params,omitempty"`
+	// Locales are the -probe-locales the URL was found in, when not all of them
+	Locales []string  `json:"locales,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// writeOptions controls how writeURLsToFile appends to a file.
+type writeOptions struct {
+	// lock takes an advisory lock on the file while writing
+	lock bool
+	// dedup skips lines that are already present in the file
+	dedup bool
+	// maxSize rotates to a new numbered file once this many bytes are reached (0 disables rotation)
+	maxSize int64
+}
+
+// rotatingFile appends lines to a file, moving on to numbered files
+// (output.001.txt, output.002.txt, ...) whenever the current one would grow
+// past maxSize. Files ending in .gz are gzip-compressed; for those the limit
+// is approximate as it counts the uncompressed bytes written.
+type rotatingFile struct {
+	filename   string
+	maxSize    int64
+	lock       bool
+	compressed bool
+
+	index  int
+	file   *os.File
+	gz     *gzip.Writer
+	writer *bufio.Writer
+	size   int64
+}
+
+// openRotatingFile opens filename for appending, continuing with the most
+// recent numbered file left behind by an earlier run when rotation is enabled.
+func openRotatingFile(filename string, maxSize int64, lock bool) (*rotatingFile, error) {
+	r := &rotatingFile{
+		filename:   filename,
+		maxSize:    maxSize,
+		lock:       lock,
+		compressed: strings.HasSuffix(filename, ".gz"),
+	}
+	if maxSize > 0 {
+		for {
+			if _, err := os.Stat(rotatedName(filename, r.index+1)); err != nil {
+				break
+			}
+			r.index++
+		}
+	}
+	return r, r.open()
+}
+
+// name returns the name of the file currently being written.
+func (r *rotatingFile) name() string {
+	return rotatedName(r.filename, r.index)
+}
+
+// parts returns the names of the base file and every numbered file up to the current one.
+func (r *rotatingFile) parts() []string {
+	names := make([]string, 0, r.index+1)
+	for i := 0; i <= r.index; i++ {
+		names = append(names, rotatedName(r.filename, i))
+	}
+	return names
+}
+
+// open opens the current file for appending and records its size.
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.name(), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if r.lock {
+		if err := lockFile(file); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	r.gz = nil
+	r.writer = nil
+	return nil
+}
+
+// WriteLine appends line and a newline, rotating first if the line would
+// take the current file past the size limit.
+func (r *rotatingFile) WriteLine(line string) error {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(line)+1) > r.maxSize {
+		if err := r.closeCurrent(); err != nil {
+			return err
+		}
+		r.index++
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	// The gzip writer is created lazily so that no empty gzip member is appended
+	if r.writer == nil {
+		var w io.Writer = r.file
+		if r.compressed {
+			r.gz = gzip.NewWriter(r.file)
+			w = r.gz
+		}
+		r.writer = bufio.NewWriter(w)
+	}
+	n, err := r.writer.WriteString(line + "\n")
+	r.size += int64(n)
+	return err
+}
+
+// Close flushes and closes the current file. It is safe to call more than once.
+func (r *rotatingFile) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.closeCurrent()
+}
+
+// closeCurrent flushes any buffered output, releases the lock and closes the current file.
+func (r *rotatingFile) closeCurrent() error {
+	var err error
+	if r.writer != nil {
+		err = r.writer.Flush()
+	}
+	if r.gz != nil {
+		if closeErr := r.gz.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if r.lock {
+		unlockFile(r.file)
+	}
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file = nil
+	return err
+}
+
+// rotatedName returns the name of the index-th rotated file for filename,
+// e.g. output.txt -> output.001.txt or output.txt.gz -> output.001.txt.gz.
+// Index 0 is filename itself.
+func rotatedName(filename string, index int) string {
+	if index == 0 {
+		return filename
+	}
+	base, gz := filename, ""
+	if strings.HasSuffix(base, ".gz") {
+		base, gz = strings.TrimSuffix(base, ".gz"), ".gz"
+	}
+	ext := filepath.Ext(base)
+	return fmt.Sprintf("%s.%03d%s%s", strings.TrimSuffix(base, ext), index, ext, gz)
+}
+
+// parseSize parses a size such as "512", "64KB", "100MB" or "2GB" into bytes.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// domainOverride adjusts filtering for hosts matching a domain pattern in the
+// -overrides file.
+type domainOverride struct {
+	JunkExtensions []string `yaml:"junk_extensions"`
+	KeepExtensions []string `yaml:"keep_extensions"`
+	Exclude        []string `yaml:"exclude"`
+	RateLimit      float64  `yaml:"rate_limit"`
+
+	excludeRes []*regexp.Regexp
+}
+
+// domainOverrides maps domain patterns ("example.com" or "*.example.com") to overrides.
+type domainOverrides map[string]*domainOverride
+
+// loadOverrides reads a YAML file mapping domain patterns to filter overrides.
+func loadOverrides(filename string) (domainOverrides, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides domainOverrides
+	if err := yaml.Unmarshal(data, &overrides); err != nil {
+		return nil, err
+	}
+	for pattern, override := range overrides {
+		if override == nil {
+			override = &domainOverride{}
+			overrides[pattern] = override
+		}
+		for _, expr := range override.Exclude {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid exclude pattern %q: %w", pattern, expr, err)
+			}
+			override.excludeRes = append(override.excludeRes, re)
+		}
+	}
+	return overrides, nil
+}
+
+// lookup returns the most specific override matching hostname along with its pattern.
+// "example.com" matches the domain and its subdomains, "*.example.com" only subdomains.
+// Longer patterns are more specific, and an exact match beats a wildcard of the same domain.
+func (o domainOverrides) lookup(hostname string) (string, *domainOverride) {
+	hostname = hostKey(hostname)
+	bestPattern, bestScore := "", -1
+	for pattern := range o {
+		domain := hostKey(strings.TrimPrefix(pattern, "*."))
+		wildcard := strings.HasPrefix(pattern, "*.")
+
+		var score int
+		switch {
+		case !wildcard && hostname == domain:
+			score = 2*len(domain) + 1
+		case strings.HasSuffix(hostname, "."+domain):
+			score = 2 * len(domain)
+		default:
+			continue
+		}
+		// Break ties deterministically so the same host always gets the same override
+		if score > bestScore || (score == bestScore && pattern < bestPattern) {
+			bestPattern, bestScore = pattern, score
+		}
+	}
+	if bestScore < 0 {
+		return "", nil
+	}
+	return bestPattern, o[bestPattern]
+}
+
+// junkExtensions returns the junk extension list after applying the override.
+func (d *domainOverride) junkExtensions() []string {
+	if d == nil {
+		return junkExtensions
+	}
+	keep := make(map[string]bool)
+	for _, ext := range d.KeepExtensions {
+		keep[normalizeExtension(ext)] = true
+	}
+	var exts []string
+	for _, ext := range junkExtensions {
+		if !keep[ext] {
+			exts = append(exts, ext)
+		}
+	}
+	for _, ext := range d.JunkExtensions {
+		if ext = normalizeExtension(ext); !keep[ext] {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// isJunk reports whether path is junk once the override is applied.
+// A nil override falls back to isJunkFile.
+func (d *domainOverride) isJunk(path string) bool {
+	if d == nil {
+		return isJunkFile(path)
+	}
+	path = strings.ToLower(path)
+	for _, ext := range d.junkExtensions() {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether u matches one of the override's exclude patterns.
+func (d *domainOverride) excluded(u string) bool {
+	if d == nil {
+		return false
+	}
+	for _, re := range d.excludeRes {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// printOverrides writes the effective configuration of every domain pattern.
+func printOverrides(o domainOverrides) {
+	patterns := make([]string, 0, len(o))
+	for pattern := range o {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		override := o[pattern]
+		fmt.Fprintf(logOutput, "%s\n", pattern)
+		fmt.Fprintf(logOutput, "  junk extensions: %s\n", strings.Join(override.junkExtensions(), " "))
+		if len(override.Exclude) > 0 {
+			fmt.Fprintf(logOutput, "  exclude: %s\n", strings.Join(override.Exclude, " "))
+		}
+		if override.RateLimit > 0 {
+			fmt.Fprintf(logOutput, "  rate limit: %g requests/second\n", override.RateLimit)
+		}
+	}
+}
+
+// normalizeExtension lowercases ext and makes sure it starts with a dot.
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDomainOverridesLookup(t *testing.T) {
+	overrides := make(domainOverrides)
+	for _, pattern := range []string{
+		"example.com",
+		"*.example.com",
+		"api.example.com",
+		"*.api.example.com",
+		"v1.api.example.com",
+		"other.org",
+		"*.Other.ORG",
+		"Tie.NET",
+		"tie.net.",
+	} {
+		overrides[pattern] = &domainOverride{}
+	}
+	tests := []struct {
+		host string
+		want string
+	}{
+		// An exact match beats a wildcard of the same domain
+		{"example.com", "example.com"},
+		{"EXAMPLE.com.", "example.com"},
+		{"api.example.com", "api.example.com"},
+		{"v1.api.example.com", "v1.api.example.com"},
+		// A longer suffix beats a shorter one
+		{"www.example.com", "*.example.com"},
+		{"v2.api.example.com", "*.api.example.com"},
+		{"deep.v1.api.example.com", "v1.api.example.com"},
+		{"a.b.example.com", "*.example.com"},
+		// Equal matches go to the pattern that sorts first
+		{"www.other.org", "*.Other.ORG"},
+		{"other.org", "other.org"},
+		{"tie.net", "Tie.NET"},
+		{"sub.tie.net", "Tie.NET"},
+		// Ports don't take part, and unrelated or lookalike hosts match nothing
+		{"api.example.com:8443", "api.example.com"},
+		{"notexample.com", ""},
+		{"example.com.evil.net", ""},
+		{"com", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		// Map order is random, so each lookup is repeated to catch unstable picks
+		for i := 0; i < 20; i++ {
+			pattern, override := overrides.lookup(tt.host)
+			if pattern != tt.want {
+				t.Errorf("lookup(%q) = %q, want %q", tt.host, pattern, tt.want)
+				break
+			}
+			if (override == nil) != (tt.want == "") || override != overrides[tt.want] {
+				t.Errorf("lookup(%q) returned the override of another pattern", tt.host)
+				break
+			}
+		}
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "overrides.yaml")
+	config := `
+example.com:
+  keep_extensions: [PNG, ".pdf"]
+  junk_extensions: [json]
+  exclude: ["/logout"]
+"*.cdn.example.com":
+empty.org: {}
+`
+	if err := os.WriteFile(filename, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	overrides, err := loadOverrides(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overrides) != 3 {
+		t.Fatalf("loaded %d overrides, want 3", len(overrides))
+	}
+	_, site := overrides.lookup("www.example.com")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/logo.png", false},
+		{"/report.PDF", false},
+		{"/data.json", true},
+		{"/photo.jpg", true},
+		{"/page", false},
+	}
+	for _, tt := range tests {
+		if got := site.isJunk(tt.path); got != tt.want {
+			t.Errorf("isJunk(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if !site.excluded("https://example.com/logout") || site.excluded("https://example.com/login") {
+		t.Error("exclude patterns applied wrongly")
+	}
+	// An empty entry still wins the lookup, with the default filters
+	if pattern, cdn := overrides.lookup("img.cdn.example.com"); pattern != "*.cdn.example.com" || cdn == nil || !cdn.isJunk("/a.png") {
+		t.Errorf("lookup(img.cdn.example.com) = %q, %v", pattern, cdn)
+	}
+
+	if err := os.WriteFile(filename, []byte("example.com:\n  exclude: [\"(\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadOverrides(filename); err == nil {
+		t.Error("an invalid exclude pattern was accepted")
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// extraAttrs maps tag names, or "*" for any tag, to the attributes whose
+// values are collected as links on top of the built-in ones, from -attr.
+var extraAttrs = make(map[string]map[string]bool)
+
+// addExtraAttr parses "tag:attribute", e.g. "div:data-endpoint", into extraAttrs.
+func addExtraAttr(spec string) error {
+	tag, attr, ok := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	if !ok || tag == "" || attr == "" {
+		return fmt.Errorf("invalid attribute %q (expected tag:attribute)", spec)
+	}
+	if extraAttrs[tag] == nil {
+		extraAttrs[tag] = make(map[string]bool)
+	}
+	extraAttrs[tag][attr] = true
+	return nil
+}
+
+// maxSrcdocDepth caps how deeply <iframe srcdoc> documents nested inside
+// each other are extracted.
+const maxSrcdocDepth = 3
+
+// pageBuilder collects the links and metadata of a page from its start tags,
+// end tags, text and comments in document order. The tokenizer behind
+// extractPage and the DOM walk behind extractParsedPage both feed it, so the
+// two extract exactly the same things.
+type pageBuilder struct {
+	pg    page
+	links []string
+	// inlineScript is set while inside a <script> without a src, and
+	// jsonScript when that script holds JSON data rather than code
+	inlineScript bool
+	jsonScript   bool
+	// hiddenText is set inside the elements whose text isn't shown: scripts, styles and the title
+	hiddenText string
+	title      strings.Builder
+	titleDone  bool
+	// inForm is set between <form> and </form>; formAction is that form's action
+	inForm     bool
+	formAction string
+	// inHead is set between <head> and </head> or <body>
+	inHead    bool
+	headLinks map[string]bool
+	bodyLinks map[string]bool
+	// srcdocDepth is how many srcdoc documents this one is nested in
+	srcdocDepth int
+}
+
+func newPageBuilder() *pageBuilder {
+	return &pageBuilder{
+		links:     make([]string, 0),
+		headLinks: make(map[string]bool),
+		bodyLinks: make(map[string]bool),
+	}
+}
+
+// attribute records the links added since before as found in the head or the body.
+func (b *pageBuilder) attribute(before int) {
+	for _, u := range b.links[before:] {
+		if b.inHead {
+			b.headLinks[u] = true
+		} else {
+			b.bodyLinks[u] = true
+		}
+	}
+}
+
+// comment handles an HTML comment.
+func (b *pageBuilder) comment(text string) {
+	b.pg.comments = append(b.pg.comments, text)
+}
+
+// text handles the text between tags.
+func (b *pageBuilder) text(text string) {
+	before := len(b.links)
+	if b.inlineScript {
+		found := extractConfigURLs
+		if b.jsonScript {
+			found = extractJSONScriptURLs
+		}
+		// Script text is raw text, so its entities are still encoded
+		for _, u := range found(text) {
+			u = decodeEntities(u)
+			b.links = append(b.links, u)
+			b.pg.configURLs = append(b.pg.configURLs, u)
+		}
+	}
+	switch b.hiddenText {
+	case "":
+		b.pg.snippet = appendSnippet(b.pg.snippet, text, snippetLength)
+	case "title":
+		if !b.titleDone {
+			b.title.WriteString(text)
+		}
+	}
+	b.attribute(before)
+}
+
+// endTag handles the end of the element called name.
+func (b *pageBuilder) endTag(name string) {
+	if name == "script" {
+		b.inlineScript, b.jsonScript = false, false
+	}
+	if name == "head" {
+		b.inHead = false
+	}
+	if name == "form" {
+		b.inForm = false
+	}
+	if blockTags[name] {
+		b.pg.snippet = appendSnippet(b.pg.snippet, " ", snippetLength)
+	}
+	if name == b.hiddenText {
+		if b.hiddenText == "title" {
+			b.titleDone = true
+		}
+		b.hiddenText = ""
+	}
+}
+
+// startTag handles an opening tag; selfClosing is set for tags written as <tag/>.
+func (b *pageBuilder) startTag(token html.Token, selfClosing bool) {
+	before := len(b.links)
+	pg := &b.pg
+	if !selfClosing && (token.Data == "script" || token.Data == "style" || token.Data == "title") {
+		b.hiddenText = token.Data
+	}
+	if token.Data == "head" || token.Data == "body" {
+		b.inHead = token.Data == "head" && !selfClosing
+	}
+	if blockTags[token.Data] {
+		pg.snippet = appendSnippet(pg.snippet, " ", snippetLength)
+	}
+	if token.Data == "script" && !selfClosing {
+		b.inlineScript = true
+		for _, attr := range token.Attr {
+			switch attr.Key {
+			case "src":
+				b.inlineScript = false
+			case "type":
+				b.jsonScript = isJSONScript(attr.Val)
+			}
+		}
+	}
+	if token.Data == "link" && isCanonical(token) {
+		for _, attr := range token.Attr {
+			if attr.Key == "href" {
+				pg.canonical = attr.Val
+			}
+		}
+	}
+	if token.Data == "a" {
+		href, hasHref := "", false
+		filename, isDownload := "", false
+		blank := false
+		for _, attr := range token.Attr {
+			switch attr.Key {
+			case "href":
+				href, hasHref = attr.Val, true
+			case "download":
+				filename, isDownload = strings.TrimSpace(attr.Val), true
+			case "target":
+				blank = strings.EqualFold(attr.Val, "_blank")
+			}
+		}
+		if hasHref {
+			b.links = append(b.links, href)
+			if isDownload {
+				if pg.downloads == nil {
+					pg.downloads = make(map[string]string)
+				}
+				pg.downloads[href] = filename
+			}
+			if blank {
+				if pg.blankTargets == nil {
+					pg.blankTargets = make(map[string]bool)
+				}
+				pg.blankTargets[href] = true
+			}
+		}
+	} else if token.Data == "meta" {
+		if content, ok := metaCardURL(token); ok {
+			b.links = append(b.links, content)
+			pg.metaCards = append(pg.metaCards, content)
+		}
+		if isMetaRobots(token) {
+			for _, attr := range token.Attr {
+				if attr.Key == "content" && robotsNoFollow(attr.Val) {
+					pg.noFollow = true
+				}
+			}
+		}
+	} else if token.Data == "form" && !b.inForm {
+		// Browsers ignore a <form> inside another, so its fields go to the outer one
+		b.inForm = !selfClosing
+		b.formAction = ""
+		for _, attr := range token.Attr {
+			if attr.Key == "action" {
+				b.formAction = strings.TrimSpace(attr.Val)
+			}
+		}
+		if b.formAction != "" {
+			b.links = append(b.links, b.formAction)
+		}
+		if pg.forms == nil {
+			pg.forms = make(map[string][]string)
+		}
+		if _, ok := pg.forms[b.formAction]; !ok {
+			pg.forms[b.formAction] = []string{}
+		}
+	} else if b.inForm && (token.Data == "input" || token.Data == "select" || token.Data == "textarea") {
+		for _, attr := range token.Attr {
+			if name := strings.TrimSpace(attr.Val); attr.Key == "name" && name != "" {
+				pg.forms[b.formAction] = appendUnique(pg.forms[b.formAction], name)
+			}
+		}
+	} else if token.Data == "iframe" {
+		for _, attr := range token.Attr {
+			if attr.Key == "src" && strings.TrimSpace(attr.Val) != "" {
+				b.links = append(b.links, attr.Val)
+				pg.iframes = append(pg.iframes, attr.Val)
+			}
+			// The tokenizer already decoded the entities the document is escaped with
+			if attr.Key == "srcdoc" && b.srcdocDepth < maxSrcdocDepth {
+				nested := newPageBuilder()
+				nested.srcdocDepth = b.srcdocDepth + 1
+				nested.consume(html.NewTokenizer(strings.NewReader(attr.Val)))
+				for _, u := range nested.links {
+					b.links = append(b.links, u)
+					if pg.srcdocLinks == nil {
+						pg.srcdocLinks = make(map[string]bool)
+					}
+					pg.srcdocLinks[u] = true
+				}
+			}
+		}
+	} else if token.Data == "frame" {
+		for _, attr := range token.Attr {
+			if attr.Key == "src" {
+				b.links = append(b.links, attr.Val)
+				pg.frames = append(pg.frames, attr.Val)
+			}
+		}
+	} else if token.Data == "script" || token.Data == "link" {
+		for _, attr := range token.Attr {
+			if attr.Key == "src" || attr.Key == "href" {
+				b.links = append(b.links, attr.Val)
+			}
+		}
+	}
+	if len(extraAttrs) > 0 {
+		for _, attr := range token.Attr {
+			if value := strings.TrimSpace(attr.Val); value != "" && (extraAttrs[token.Data][attr.Key] || extraAttrs["*"][attr.Key]) {
+				b.links = append(b.links, value)
+				if pg.attrLinks == nil {
+					pg.attrLinks = make(map[string]string)
+				}
+				pg.attrLinks[value] = token.Data + ":" + attr.Key
+			}
+		}
+	}
+	b.attribute(before)
+}
+
+// appendUnique appends s to list unless it is already there.
+func appendUnique(list []string, s string) []string {
+	for _, existing := range list {
+		if existing == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// finish returns the page built so far, with err recording a read failure if any.
+func (b *pageBuilder) finish(err error) page {
+	pg := b.pg
+	pg.err = err
+	pg.links = b.links
+	for u := range b.bodyLinks {
+		delete(b.headLinks, u)
+	}
+	pg.headLinks = b.headLinks
+	pg.title = strings.Join(strings.Fields(b.title.String()), " ")
+	pg.snippet = strings.TrimSpace(pg.snippet)
+	return pg
+}
+
+// extractParsedPage is extractPage for -strict-parse=false: the body is parsed
+// into a DOM tree the way a browser would, repairing misnested and unclosed
+// tags, and the tree is walked in document order. Scripting is off, as in a
+// browser with JavaScript disabled, so <noscript> content is parsed as markup
+// rather than skipped as text, and <style> or <title> inside SVG and MathML
+// isn't mistaken for raw text. It costs more time and memory than the
+// tokenizer but recovers links that it loses in badly broken markup. A body
+// that fails part way, e.g. cut off by -max-body-read-time, is parsed as far
+// as it was read, as the tokenizer would.
+func extractParsedPage(body io.Reader, baseURL string) page {
+	b := newPageBuilder()
+	data, readErr := io.ReadAll(body)
+	doc, err := html.ParseWithOptions(bytes.NewReader(data), html.ParseOptionEnableScripting(false))
+	if err != nil {
+		return b.finish(err)
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			b.startTag(html.Token{Type: html.StartTagToken, Data: n.Data, Attr: n.Attr}, false)
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+			b.endTag(n.Data)
+			return
+		case html.TextNode:
+			b.text(n.Data)
+		case html.CommentNode:
+			b.comment(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return b.finish(readErr)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestBrokenHTML checks the links the DOM extractor recovers from markup the
+// tokenizer loses track of, such as an unclosed <title> inside an <svg>.
+func TestBrokenHTML(t *testing.T) {
+	data, err := os.ReadFile("testdata/broken.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"tokenizer": {"/ok"},
+		"dom":       {"/ok", "/noscript-fallback", "/svg-link", "/in-math-style", "/after-stray-quote", "/unclosed-p"},
+	}
+	for name, extract := range extractors {
+		got := extract(bytes.NewReader(data), "https://example.com/").links
+		if strings.Join(got, " ") != strings.Join(want[name], " ") {
+			t.Errorf("%s: links = %q, want %q", name, got, want[name])
+		}
+	}
+}
+
+// TestFormFixtures checks the fields collected for each form action on pages
+// with several forms, a form nested in another, an unclosed form and forms
+// without an action, through both extractors.
+func TestFormFixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		forms   map[string][]string
+		links   []string
+	}{
+		{"forms-multi.html", map[string][]string{
+			// Both /login forms share one entry, and nameless fields are skipped
+			"/login":  {"user", "pass", "csrf"},
+			"/search": {"category", "q"},
+		}, []string{"/login", "/search", "/login"}},
+		{"forms-nested.html", map[string][]string{
+			// Browsers drop the inner <form> tag, so its fields belong to the outer
+			// form, and its </form> ends the outer one before "third"
+			"/outer": {"first", "second"},
+			"/next":  {"fourth"},
+		}, []string{"/outer", "/next"}},
+		{"forms-unclosed.html", map[string][]string{
+			"/subscribe": {"email", "plan", "note"},
+		}, []string{"/subscribe"}},
+		{"forms-actionless.html", map[string][]string{
+			"":        {"token", "comment", "rating"},
+			"/report": {},
+		}, []string{"/report"}},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile("testdata/" + tt.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, extract := range extractors {
+			pg := extract(bytes.NewReader(data), "https://example.com/")
+			if len(pg.forms) != len(tt.forms) {
+				t.Errorf("%s, %s: forms = %q, want %q", tt.fixture, name, pg.forms, tt.forms)
+			}
+			for action, fields := range tt.forms {
+				got, ok := pg.forms[action]
+				if !ok || strings.Join(got, " ") != strings.Join(fields, " ") {
+					t.Errorf("%s, %s: fields of %q = %q, want %q", tt.fixture, name, action, got, fields)
+				}
+			}
+			if strings.Join(pg.links, " ") != strings.Join(tt.links, " ") {
+				t.Errorf("%s, %s: links = %q, want %q", tt.fixture, name, pg.links, tt.links)
+			}
+		}
+	}
+}
+
+// TestSrcdocFixture checks the links of srcdoc documents, each nested one
+// escaped once more, down to maxSrcdocDepth levels deep and no further.
+func TestSrcdocFixture(t *testing.T) {
+	data, err := os.ReadFile("testdata/srcdoc.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, inSrcdoc []string
+	want = append(want, "/top")
+	for level := 1; level <= maxSrcdocDepth; level++ {
+		want = append(want, fmt.Sprintf("/level%d", level))
+	}
+	inSrcdoc = append(inSrcdoc, want[1:]...)
+	want = append(want, "/framed", "/sibling?a=1&b=2", "/srcdoc.js", "/bottom")
+	inSrcdoc = append(inSrcdoc, "/sibling?a=1&b=2", "/srcdoc.js")
+
+	for name, extract := range extractors {
+		pg := extract(bytes.NewReader(data), "https://example.com/")
+		if strings.Join(pg.links, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: links = %q, want %q", name, pg.links, want)
+		}
+		if len(pg.srcdocLinks) != len(inSrcdoc) {
+			t.Errorf("%s: srcdoc links = %v, want %q", name, pg.srcdocLinks, inSrcdoc)
+		}
+		for _, u := range inSrcdoc {
+			if !pg.srcdocLinks[u] {
+				t.Errorf("%s: %q isn't marked as a srcdoc link", name, u)
+			}
+		}
+		if cut := fmt.Sprintf("/level%d", maxSrcdocDepth+1); containsString(pg.links, cut) {
+			t.Errorf("%s: %s, past maxSrcdocDepth, was extracted", name, cut)
+		}
+	}
+}
+
+// TestFramesetFixtures checks that the frames of nested framesets are all
+// collected, in order, by both extractors.
+func TestFramesetFixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		frames  []string
+	}{
+		{"frameset.html", []string{"/nav.html", "/top.html", "{{external}}/ad.html"}},
+		{"frameset-inner.html", []string{"inner.html"}},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile("testdata/" + tt.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, extract := range extractors {
+			pg := extract(bytes.NewReader(data), "https://example.com/")
+			if strings.Join(pg.frames, " ") != strings.Join(tt.frames, " ") {
+				t.Errorf("%s, %s: frames = %q, want %q", tt.fixture, name, pg.frames, tt.frames)
+			}
+			for _, frame := range tt.frames {
+				if !containsString(pg.links, frame) {
+					t.Errorf("%s, %s: links don't include frame %q", tt.fixture, name, frame)
+				}
+			}
+		}
+	}
+}
+
+// benchmarkPage is a well-formed page of about 150KB with a few thousand links.
+var benchmarkPage = func() []byte {
+	var b bytes.Buffer
+	b.WriteString(`<!DOCTYPE html><html><head><title>Bench</title><link rel="stylesheet" href="/css/site.css"></head><body>`)
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&b, `<div class="item"><a href="/item/%d?ref=list&amp;page=%d">Item %d</a><img src="/img/%d.png" alt="">`, i, i/20, i, i)
+		fmt.Fprintf(&b, `<p>Some descriptive text for item %d, long enough to look like a real listing.</p></div>`+"\n", i)
+	}
+	b.WriteString(`<script src="/js/app.js"></script></body></html>`)
+	return b.Bytes()
+}()
+
+// BenchmarkExtractPage measures the cost of -strict-parse=false against the
+// tokenizer, on a large well-formed page and on the broken fixture.
+func BenchmarkExtractPage(b *testing.B) {
+	broken, err := os.ReadFile("testdata/broken.html")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, doc := range []struct {
+		name string
+		data []byte
+	}{{"large", benchmarkPage}, {"broken", broken}} {
+		for name, extract := range extractors {
+			b.Run(doc.name+"/"+name, func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(doc.data)))
+				for i := 0; i < b.N; i++ {
+					extract(bytes.NewReader(doc.data), "https://example.com/")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+var (
+	errNotPDF       = errors.New("not a PDF document")
+	errPDFEncrypted = errors.New("PDF document is encrypted")
+
+	// pdfURIString matches URI actions written as literal strings, e.g. /URI (https://example.com)
+	pdfURIString = regexp.MustCompile(`/URI\s*\(((?:\\.|[^\\)])*)\)`)
+	// pdfURIHex matches URI actions written as hex strings, e.g. /URI <68747470...>
+	pdfURIHex = regexp.MustCompile(`/URI\s*<([0-9A-Fa-f\s]*)>`)
+	// pdfStream matches a stream object along with the dictionary that precedes it
+	pdfStream = regexp.MustCompile(`(?s)<<(.{0,1000}?)>>\s*stream\r?\n(.*?)\r?\n?endstream`)
+	// pdfTextURL matches absolute URLs appearing in extracted text
+	pdfTextURL = regexp.MustCompile(`https?://[^\s<>()\[\]{}"'\\]+`)
+)
+
+// fetchPDFLinks downloads the PDF at u, reading at most maxBody bytes, and
+// returns the URLs found inside it.
+func fetchPDFLinks(ctx context.Context, client *http.Client, u, userAgent string, maxBody int64) ([]string, error) {
+	data, err := fetchBody(ctx, client, u, userAgent, maxBody)
+	if err != nil {
+		return nil, err
+	}
+	return extractPDFLinks(data)
+}
+
+// extractPDFLinks returns the URLs found in a PDF document, both from URI actions
+// in link annotations and from the text of its (possibly Flate-compressed) streams.
+func extractPDFLinks(data []byte) ([]string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-")) {
+		return nil, errNotPDF
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return nil, errPDFEncrypted
+	}
+
+	// Annotations and text may live in compressed object streams, so scan the
+	// raw file along with every stream that can be decompressed.
+	sources := [][]byte{data}
+	for _, m := range pdfStream.FindAllSubmatch(data, -1) {
+		if !bytes.Contains(m[1], []byte("/FlateDecode")) {
+			continue
+		}
+		r, err := zlib.NewReader(bytes.NewReader(m[2]))
+		if err != nil {
+			continue
+		}
+		// Keep whatever decompressed before an error; truncated streams are common
+		decoded, _ := io.ReadAll(r)
+		r.Close()
+		sources = append(sources, decoded)
+	}
+
+	seen := make(map[string]struct{})
+	var links []string
+	add := func(link string) {
+		if link == "" {
+			return
+		}
+		if _, ok := seen[link]; !ok {
+			seen[link] = struct{}{}
+			links = append(links, link)
+		}
+	}
+
+	for _, src := range sources {
+		for _, m := range pdfURIString.FindAllSubmatch(src, -1) {
+			add(string(unescapePDFString(m[1])))
+		}
+		for _, m := range pdfURIHex.FindAllSubmatch(src, -1) {
+			add(string(decodePDFHex(m[1])))
+		}
+		// URI actions were handled above and may contain escapes the text scan would mangle
+		src = pdfURIHex.ReplaceAll(pdfURIString.ReplaceAll(src, nil), nil)
+		for _, m := range pdfTextURL.FindAll(src, -1) {
+			add(string(m))
+		}
+	}
+	return links, nil
+}
+
+// unescapePDFString decodes the escape sequences of a PDF literal string.
+func unescapePDFString(s []byte) []byte {
+	var out bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 't':
+			out.WriteByte('\t')
+		case 'b':
+			out.WriteByte('\b')
+		case 'f':
+			out.WriteByte('\f')
+		case '\r', '\n':
+			// Line continuation
+		default:
+			if c >= '0' && c <= '7' {
+				j := i
+				for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+					j++
+				}
+				n, _ := strconv.ParseUint(string(s[i:j]), 8, 8)
+				out.WriteByte(byte(n))
+				i = j - 1
+			} else {
+				out.WriteByte(c)
+			}
+		}
+	}
+	return out.Bytes()
+}
+
+// decodePDFHex decodes a PDF hex string, ignoring whitespace and padding an odd final digit.
+func decodePDFHex(s []byte) []byte {
+	digits := make([]byte, 0, len(s)+1)
+	for _, c := range s {
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(n)
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// preflight sends a HEAD request to u and reports whether it is reachable.
+// Any response counts, whatever its status; only timeouts, DNS failures and
+// refused or reset connections make a target unreachable. Other errors, such
+// as certificate problems, are left for the crawl itself to report.
+func preflight(ctx context.Context, client *http.Client, u, userAgent string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", u, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		return true, nil
+	}
+
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) || (errors.As(err, &netErr) && netErr.Timeout()) || isRefusedOrReset(err) {
+		return false, err
+	}
+	return true, err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisTimeout bounds each command sent to Redis
+	redisTimeout = 5 * time.Second
+	// redisQueueSize is how many URLs may wait to be pushed; URLs found while
+	// the queue is full are dropped rather than holding up the crawl
+	redisQueueSize = 10000
+	// redisBatch caps the URLs sent in one RPUSH
+	redisBatch = 500
+)
+
+// redisSink pushes extracted URLs onto a Redis list as they are found, so
+// that downstream tools can consume them while the crawl is still running.
+// URLs are queued and pushed in batches by a goroutine of its own, so a slow
+// or unreachable server never blocks the workers.
+type redisSink struct {
+	client *redis.Client
+	key    string
+	queue  chan string
+	done   chan struct{}
+	// failed counts URLs that couldn't be pushed, or were dropped from a full queue
+	failed int64
+}
+
+// newRedisSink connects to the Redis server at rawURL (redis://[user:pass@]host:port/db),
+// checks that it answers and starts pushing.
+func newRedisSink(rawURL, key string) (*redisSink, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	r := &redisSink{client: client, key: key, queue: make(chan string, redisQueueSize), done: make(chan struct{})}
+	go r.run()
+	return r, nil
+}
+
+// run pushes the queued URLs until the queue is closed, sending whatever has
+// piled up since the last push in one RPUSH.
+func (r *redisSink) run() {
+	defer close(r.done)
+	batch := make([]interface{}, 0, redisBatch)
+	for u := range r.queue {
+		batch = append(batch[:0], u)
+	fill:
+		for len(batch) < redisBatch {
+			select {
+			case u, ok := <-r.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, u)
+			default:
+				break fill
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		err := r.client.RPush(ctx, r.key, batch...).Err()
+		cancel()
+		if err != nil {
+			r.fail(err, len(batch))
+		}
+	}
+}
+
+// fail counts n URLs that weren't pushed, warning about the first.
+func (r *redisSink) fail(err error, n int) {
+	if atomic.AddInt64(&r.failed, int64(n)) == int64(n) {
+		fmt.Fprintln(logOutput, color.YellowString("Warning: Could not push to Redis:"), err)
+	}
+}
+
+// push queues u to be appended to the list, dropping it when the queue is
+// full. It never waits, so it is safe to call with locks held. A nil sink
+// does nothing.
+func (r *redisSink) push(u string) {
+	if r == nil {
+		return
+	}
+	select {
+	case r.queue <- u:
+	default:
+		r.fail(fmt.Errorf("queue of %d URLs full", redisQueueSize), 1)
+	}
+}
+
+// Close pushes the queued URLs, closes the connection and returns how many
+// of all the URLs given to push didn't make it. A nil sink does nothing.
+func (r *redisSink) Close() int64 {
+	if r == nil {
+		return 0
+	}
+	close(r.queue)
+	<-r.done
+	r.client.Close()
+	return atomic.LoadInt64(&r.failed)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// fetchErrorClass is the kind of failure behind a fetch, which decides how
+// many times it is retried.
+type fetchErrorClass int
+
+const (
+	// classNone is a success, or a failure that retrying won't fix
+	classNone fetchErrorClass = iota
+	classDNS
+	classConnect
+	classTLS
+	// classHTTP is a 5xx response
+	classHTTP
+)
+
+func (c fetchErrorClass) String() string {
+	switch c {
+	case classDNS:
+		return "dns"
+	case classConnect:
+		return "connect"
+	case classTLS:
+		return "tls"
+	case classHTTP:
+		return "http"
+	}
+	return "none"
+}
+
+const (
+	// retryBackoff is the delay before the first retry; each later one doubles it
+	retryBackoff = 500 * time.Millisecond
+	// maxRetryAfter is the longest Retry-After that is waited out; servers
+	// asking for more are not retried
+	maxRetryAfter = time.Minute
+)
+
+// retryPolicy holds the number of retries allowed for each class of failure,
+// from -retries-dns, -retries-connect, -retries-tls and -retries-http.
+type retryPolicy struct {
+	dns, connect, tls, http int
+}
+
+// classifyFetch returns the class of a fetch's failure: err when the request
+// failed, otherwise the status of resp.
+func classifyFetch(err error, resp *http.Response) fetchErrorClass {
+	if err == nil {
+		if resp != nil && resp.StatusCode >= 500 {
+			return classHTTP
+		}
+		return classNone
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		// A name that doesn't exist won't exist a moment later either
+		if dnsErr.IsNotFound {
+			return classNone
+		}
+		return classDNS
+	}
+	// Certificate problems and plain http on the port are permanent;
+	// handshakes cut short by middleboxes are not
+	if isPermanentTLSError(err) {
+		return classNone
+	}
+	if isTLSError(err) {
+		return classTLS
+	}
+	if isRefusedOrReset(err) {
+		return classConnect
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return classConnect
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return classConnect
+	}
+	return classNone
+}
+
+// isPermanentTLSError reports whether err is a certificate the client
+// rejected, or a server answering a TLS handshake with something else, as
+// plain http on an https port does.
+func isPermanentTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+	return errors.As(err, &unknownAuthority) || errors.As(err, &hostname) ||
+		errors.As(err, &invalid) || errors.As(err, &recordHeader)
+}
+
+// retryDelay decides whether a fetch that failed on its attempt'th try
+// (counting from 0) is tried again, and after how long. A Retry-After on the
+// response is honored when it isn't longer than maxRetryAfter.
+func retryDelay(policy retryPolicy, err error, resp *http.Response, attempt int) (time.Duration, bool) {
+	class := classifyFetch(err, resp)
+	budget := 0
+	switch class {
+	case classDNS:
+		budget = policy.dns
+	case classConnect:
+		budget = policy.connect
+	case classTLS:
+		budget = policy.tls
+	case classHTTP:
+		budget = policy.http
+	}
+	if attempt >= budget {
+		return 0, false
+	}
+	delay := retryBackoff << attempt
+	if class == classHTTP {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if after > maxRetryAfter {
+				return 0, false
+			}
+			delay = after
+		}
+	}
+	return delay, true
+}
+
+// parseRetryAfter parses a Retry-After value, given in seconds or as a date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fetchErr wraps err the way http.Client.Do returns it.
+func fetchErr(err error) error {
+	return &url.Error{Op: "Get", URL: "https://example.com/", Err: err}
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// status returns a response with code and the given Retry-After, if any.
+func status(code int, retryAfter string) *http.Response {
+	resp := &http.Response{StatusCode: code, Header: make(http.Header)}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func TestClassifyFetch(t *testing.T) {
+	cert := &x509.Certificate{DNSNames: []string{"other.example.com"}}
+	tests := []struct {
+		name string
+		err  error
+		resp *http.Response
+		want fetchErrorClass
+	}{
+		{"ok", nil, status(200, ""), classNone},
+		{"not found", nil, status(404, ""), classNone},
+		{"503", nil, status(503, ""), classHTTP},
+		{"503 with Retry-After", nil, status(503, "5"), classHTTP},
+		{"no response", nil, nil, classNone},
+		{"nxdomain", fetchErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "nope.example.com", IsNotFound: true}}), nil, classNone},
+		{"dns timeout", fetchErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}}), nil, classDNS},
+		{"dns server failure", fetchErr(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "server misbehaving", Name: "example.com"}}), nil, classDNS},
+		{"refused", fetchErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), nil, classConnect},
+		{"reset", fetchErr(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), nil, classConnect},
+		{"unreachable", fetchErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)}), nil, classConnect},
+		{"read timeout", fetchErr(&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}), nil, classConnect},
+		{"unknown authority", fetchErr(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), nil, classNone},
+		{"wrong host", fetchErr(&tls.CertificateVerificationError{Err: x509.HostnameError{Certificate: cert, Host: "example.com"}}), nil, classNone},
+		{"expired", fetchErr(&tls.CertificateVerificationError{Err: x509.CertificateInvalidError{Cert: cert, Reason: x509.Expired}}), nil, classNone},
+		{"plain http", fetchErr(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), nil, classNone},
+		{"handshake cut short", fetchErr(errors.New("remote error: tls: handshake failure")), nil, classTLS},
+		{"cancelled", fetchErr(context.Canceled), nil, classNone},
+		{"other", fetchErr(errors.New("unsupported protocol scheme")), nil, classNone},
+	}
+	for _, tt := range tests {
+		if got := classifyFetch(tt.err, tt.resp); got != tt.want {
+			t.Errorf("%s: classifyFetch = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := retryPolicy{dns: 1, connect: 2, tls: 1, http: 2}
+	refused := fetchErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)})
+	dnsFailure := fetchErr(&net.DNSError{Err: "server misbehaving", Name: "example.com"})
+	tests := []struct {
+		name    string
+		err     error
+		resp    *http.Response
+		attempt int
+		delay   time.Duration
+		retry   bool
+	}{
+		{"connect, first retry", refused, nil, 0, retryBackoff, true},
+		{"connect, backing off", refused, nil, 1, 2 * retryBackoff, true},
+		{"connect, out of retries", refused, nil, 2, 0, false},
+		{"dns", dnsFailure, nil, 0, retryBackoff, true},
+		{"dns, out of retries", dnsFailure, nil, 1, 0, false},
+		{"503 without Retry-After", nil, status(503, ""), 1, 2 * retryBackoff, true},
+		{"503 with Retry-After", nil, status(503, "3"), 0, 3 * time.Second, true},
+		{"503 with Retry-After 0", nil, status(503, "0"), 0, 0, true},
+		{"503 with a past date", nil, status(503, "Wed, 21 Oct 2015 07:28:00 GMT"), 0, 0, true},
+		{"503 asking for too long", nil, status(503, "120"), 0, 0, false},
+		{"503 with a bad Retry-After", nil, status(503, "soon"), 0, retryBackoff, true},
+		{"503, out of retries", nil, status(503, "1"), 2, 0, false},
+		{"ok", nil, status(200, ""), 0, 0, false},
+		{"permanent", fetchErr(x509.UnknownAuthorityError{}), nil, 0, 0, false},
+	}
+	for _, tt := range tests {
+		delay, retry := retryDelay(policy, tt.err, tt.resp, tt.attempt)
+		if delay != tt.delay || retry != tt.retry {
+			t.Errorf("%s: retryDelay = %v, %v, want %v, %v", tt.name, delay, retry, tt.delay, tt.retry)
+		}
+	}
+
+	// With no retries configured nothing is retried
+	if _, retry := retryDelay(retryPolicy{}, refused, nil, 0); retry {
+		t.Error("retried with an empty policy")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"30", 30 * time.Second, true},
+		{"-5", 0, false},
+		{"1.5", 0, false},
+		{"soon", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// A date in the future is waited out until then
+	future := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	if got, ok := parseRetryAfter(future); !ok || got < 80*time.Second || got > 90*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %v, %v, want about 90s", future, got, ok)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// rewriteRule is one sed-like substitution, written as s|pattern|replacement|.
+type rewriteRule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// rewriter applies its rules to a URL in order, each rule seeing the result of the previous one.
+type rewriter []rewriteRule
+
+// parseRewriter parses a list of rules in the form s|pattern|replacement|.
+// Any character after the s can serve as the delimiter and is escaped with a
+// backslash when it appears inside the pattern or replacement. The pattern is
+// a Go regular expression, every match is replaced and the replacement may
+// refer to groups as $1 or ${name}.
+func parseRewriter(rules []string) (rewriter, error) {
+	var r rewriter
+	for _, rule := range rules {
+		parsed, err := parseRewriteRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, parsed)
+	}
+	return r, nil
+}
+
+// parseRewriteRule parses a single s|pattern|replacement| rule.
+func parseRewriteRule(rule string) (rewriteRule, error) {
+	if len(rule) < 2 || rule[0] != 's' {
+		return rewriteRule{}, fmt.Errorf("invalid rewrite rule %q (expected s|pattern|replacement|)", rule)
+	}
+	delim := rule[1]
+
+	var parts []string
+	var part strings.Builder
+	for i := 2; i < len(rule); i++ {
+		switch {
+		case rule[i] == '\\' && i+1 < len(rule) && rule[i+1] == delim:
+			part.WriteByte(delim)
+			i++
+		case rule[i] == delim:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(rule[i])
+		}
+	}
+	if len(parts) != 2 || part.Len() > 0 {
+		return rewriteRule{}, fmt.Errorf("invalid rewrite rule %q (expected s%cpattern%creplacement%c)", rule, delim, delim, delim)
+	}
+
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return rewriteRule{}, fmt.Errorf("invalid rewrite pattern in %q: %w", rule, err)
+	}
+	return rewriteRule{re: re, repl: parts[1]}, nil
+}
+
+// rewrite returns u with every rule applied.
+func (r rewriter) rewrite(u string) string {
+	for _, rule := range r {
+		u = rule.re.ReplaceAllString(u, rule.repl)
+	}
+	return u
+}
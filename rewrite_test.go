@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRewriteRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		pattern string
+		repl    string
+	}{
+		{`s|old|new|`, `old`, `new`},
+		{`s|\?.*||`, `\?.*`, ``},
+		// An escaped delimiter stands for itself, other escapes are left to the regexp
+		{`s/\/v1\//\/v2\//`, `/v1/`, `/v2/`},
+		{`s#\#frag##`, `#frag`, ``},
+		{`s|\d+|N|`, `\d+`, `N`},
+		{`s,a\,b,c,`, `a,b`, `c`},
+		{`s|(?P<id>\d+)|${id}x|`, `(?P<id>\d+)`, `${id}x`},
+	}
+	for _, tt := range tests {
+		rule, err := parseRewriteRule(tt.rule)
+		if err != nil {
+			t.Errorf("parseRewriteRule(%q): %v", tt.rule, err)
+			continue
+		}
+		if rule.re.String() != tt.pattern || rule.repl != tt.repl {
+			t.Errorf("parseRewriteRule(%q) = %q -> %q, want %q -> %q", tt.rule, rule.re, rule.repl, tt.pattern, tt.repl)
+		}
+	}
+}
+
+func TestParseRewriteRuleErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{``, "expected s|pattern|replacement|"},
+		{`s`, "expected s|pattern|replacement|"},
+		{`x|a|b|`, "expected s|pattern|replacement|"},
+		{`s|a|b`, "expected s|pattern|replacement|"},
+		{`s|a|`, "expected s|pattern|replacement|"},
+		{`s|a|b|c|`, "expected s|pattern|replacement|"},
+		{`s|a|b|trailing`, "expected s|pattern|replacement|"},
+		{`s/a/b\/`, "expected s/pattern/replacement/"},
+		{`s|(|x|`, "invalid rewrite pattern"},
+	}
+	for _, tt := range tests {
+		_, err := parseRewriteRule(tt.rule)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseRewriteRule(%q) error = %v, want one containing %q", tt.rule, err, tt.want)
+		}
+	}
+	if _, err := parseRewriter([]string{`s|a|b|`, `s|(|x|`}); err == nil {
+		t.Error("parseRewriter accepted a list with an invalid rule")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		in    string
+		want  string
+	}{
+		{"no rules", nil, "http://example.com/a", "http://example.com/a"},
+		{"no match", []string{`s|/admin/|/x/|`}, "http://example.com/a?b=1", "http://example.com/a?b=1"},
+		{"every match", []string{`s|/\d+|/N|`}, "http://example.com/users/12/posts/7", "http://example.com/users/N/posts/N"},
+		{"groups", []string{`s|/v(\d+)/|/api/v$1/|`}, "http://example.com/v2/users", "http://example.com/api/v2/users"},
+		{"named groups", []string{`s|id=(?P<id>\d+)|id=${id}&old=1|`}, "http://example.com/?id=42", "http://example.com/?id=42&old=1"},
+		{"strip query", []string{`s|\?.*$||`}, "http://example.com/a?utm_source=x", "http://example.com/a"},
+		// Each rule sees the result of the ones before it
+		{"chained", []string{`s|^http://|https://|`, `s|^https://old\.|https://new.|`}, "http://old.example.com/", "https://new.example.com/"},
+		{"order matters", []string{`s|^https://old\.|https://new.|`, `s|^http://|https://|`}, "http://old.example.com/", "https://old.example.com/"},
+		{"later rule undoes earlier", []string{`s|/a|/b|`, `s|/b|/a|`}, "http://example.com/a", "http://example.com/a"},
+	}
+	for _, tt := range tests {
+		r, err := parseRewriter(tt.rules)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := r.rewrite(tt.in); got != tt.want {
+			t.Errorf("%s: rewrite(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
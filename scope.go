@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// scopeLookupTimeout bounds the lookup of a host checked against the -scope-file networks
+	scopeLookupTimeout = 5 * time.Second
+	// scopeLookupWorkers caps the lookups resolve makes at once
+	scopeLookupWorkers = 8
+)
+
+// scopeList holds the in-scope hosts loaded with -scope-file, which replace
+// the target-and-subdomains scope of every target.
+type scopeList struct {
+	// hosts are in scope exactly
+	hosts map[string]struct{}
+	// suffixes put the subdomains of a domain in scope, from *.example.com
+	// lines; each is stored with its leading dot
+	suffixes []string
+	// networks put IP hosts, and hosts resolving into them, in scope
+	networks []*net.IPNet
+
+	// lookup resolves hostnames for the networks; resolved caches the answers
+	lookup   func(ctx context.Context, host string) ([]string, error)
+	mu       sync.Mutex
+	resolved map[string]bool
+}
+
+// loadScopeList reads a scope file. Each line is a hostname, a wildcard such
+// as *.example.com (its subdomains, not example.com itself), an IP address or
+// a CIDR range. URLs are reduced to their hostname. Blank lines and lines
+// starting with # are ignored.
+func loadScopeList(filename string, lookup func(ctx context.Context, host string) ([]string, error)) (*scopeList, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := &scopeList{hosts: make(map[string]struct{}), lookup: lookup, resolved: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "://") {
+			parsed, err := url.Parse(line)
+			if err != nil || parsed.Hostname() == "" {
+				return nil, fmt.Errorf("line %d: invalid URL %q", n, line)
+			}
+			line = parsed.Hostname()
+		}
+		switch {
+		case strings.Contains(line, "/"):
+			_, network, err := net.ParseCIDR(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			s.networks = append(s.networks, network)
+		case parseIPHost(line) != nil:
+			ip := parseIPHost(line)
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			s.networks = append(s.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		case strings.HasPrefix(line, "*."):
+			s.suffixes = append(s.suffixes, line[1:])
+		default:
+			s.hosts[hostKey(line)] = struct{}{}
+		}
+	}
+	return s, scanner.Err()
+}
+
+// allows reports whether host is in scope. Hostnames only match the networks
+// when one of their addresses does; lookups are made once per host, and are
+// normally already cached by resolve.
+func (s *scopeList) allows(host string) bool {
+	host = hostKey(host)
+	if ok, decided := s.match(host); decided {
+		return ok
+	}
+	s.mu.Lock()
+	ok, done := s.resolved[host]
+	s.mu.Unlock()
+	if done {
+		return ok
+	}
+	return s.lookupHost(host)
+}
+
+// match checks host against the entries that need no lookup. decided is
+// false for hostnames that only a lookup can place in the networks.
+func (s *scopeList) match(host string) (ok, decided bool) {
+	if host == "" {
+		return false, true
+	}
+	if _, ok := s.hosts[host]; ok {
+		return true, true
+	}
+	for _, suffix := range s.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true, true
+		}
+	}
+	if len(s.networks) == 0 {
+		return false, true
+	}
+	if ip := parseIPHost(host); ip != nil {
+		return s.contains(ip), true
+	}
+	return false, false
+}
+
+// lookupHost resolves host and caches whether one of its addresses is in the
+// networks. mu is only held to update the cache, so lookups of different
+// hosts don't wait on each other.
+func (s *scopeList) lookupHost(host string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), scopeLookupTimeout)
+	defer cancel()
+	addrs, _ := s.lookup(ctx, host)
+	ok := false
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && s.contains(ip) {
+			ok = true
+			break
+		}
+	}
+	s.mu.Lock()
+	s.resolved[host] = ok
+	s.mu.Unlock()
+	return ok
+}
+
+// resolve looks up the hosts that allows can't decide without DNS, up to
+// scopeLookupWorkers at a time. The crawl calls it with the hosts of a page's
+// links before taking its own lock, so that allows finds the answers cached
+// rather than holding every worker up while a lookup times out.
+func (s *scopeList) resolve(hosts []string) {
+	pending := make(map[string]struct{})
+	s.mu.Lock()
+	for _, host := range hosts {
+		host = hostKey(host)
+		if _, decided := s.match(host); decided {
+			continue
+		}
+		if _, done := s.resolved[host]; !done {
+			pending[host] = struct{}{}
+		}
+	}
+	s.mu.Unlock()
+
+	sem := make(chan struct{}, scopeLookupWorkers)
+	var wg sync.WaitGroup
+	for host := range pending {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.lookupHost(host)
+		}(host)
+	}
+	wg.Wait()
+}
+
+// contains reports whether ip is inside one of the networks.
+func (s *scopeList) contains(ip net.IP) bool {
+	for _, network := range s.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// seeds returns the hosts of the list as targets, sorted, for runs started
+// from the scope alone. With wildcards set, each *.example.com entry is
+// returned as written too, to be expanded by -expand-wildcards; IPs and CIDR
+// ranges are left to -asn.
+func (s *scopeList) seeds(wildcards bool) []string {
+	seeds := make([]string, 0, len(s.hosts)+len(s.suffixes))
+	for host := range s.hosts {
+		seeds = append(seeds, host)
+	}
+	if wildcards {
+		for _, suffix := range s.suffixes {
+			seeds = append(seeds, "*"+suffix)
+		}
+	}
+	sort.Strings(seeds)
+	return seeds
+}
+
+// size returns the number of entries in the list.
+func (s *scopeList) size() int {
+	return len(s.hosts) + len(s.suffixes) + len(s.networks)
+}
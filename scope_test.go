@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeScopeFile writes content to a scope file in a temporary directory.
+func writeScopeFile(t *testing.T, content string) string {
+	filename := filepath.Join(t.TempDir(), "scope.txt")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// fakeLookup answers lookups from addrs, counting them per host.
+type fakeLookup struct {
+	mu    sync.Mutex
+	addrs map[string][]string
+	calls map[string]int
+}
+
+func (f *fakeLookup) lookup(ctx context.Context, host string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[host]++
+	if addrs, ok := f.addrs[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func (f *fakeLookup) total() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		n += c
+	}
+	return n
+}
+
+func TestLoadScopeList(t *testing.T) {
+	lookups := &fakeLookup{addrs: map[string][]string{
+		"inside.test":  {"192.0.2.1", "203.0.113.9"},
+		"outside.test": {"198.51.100.1"},
+		"v6.test":      {"2001:db8::10"},
+	}}
+	scope, err := loadScopeList(writeScopeFile(t, `
+# comment
+Example.COM
+https://app.example.org:8443/login
+*.example.net
+203.0.113.9
+2001:db8::/64
+10.0.0.0/8
+[2001:db8:1::1]
+`), lookups.lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scope.size(); got != 7 {
+		t.Errorf("size() = %d, want 7", got)
+	}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.com.", true},
+		{"www.example.com", false},
+		{"app.example.org", true},
+		{"example.org", false},
+		{"api.example.net", true},
+		{"a.b.example.net", true},
+		{"example.net", false},
+		{"notexample.net", false},
+		{"203.0.113.9", true},
+		{"203.0.113.10", false},
+		{"10.1.2.3", true},
+		{"2001:db8::1", true},
+		{"[2001:db8::1]", true},
+		{"2001:db8:1::1", true},
+		{"2001:db8:2::1", false},
+		{"inside.test", true},
+		{"outside.test", false},
+		{"v6.test", true},
+		{"unknown.test", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := scope.allows(tt.host); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+	want := []string{"app.example.org", "example.com"}
+	if got := scope.seeds(false); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("seeds(false) = %q, want %q", got, want)
+	}
+	want = append([]string{"*.example.net"}, want...)
+	if got := scope.seeds(true); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("seeds(true) = %q, want %q", got, want)
+	}
+}
+
+func TestLoadScopeListErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"bad cidr", "example.com\n10.0.0.0/33\n", "line 2"},
+		{"bad url", "# scope\nhttp://\n", "line 2: invalid URL"},
+		{"path", "example.com/admin\n", "line 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadScopeList(writeScopeFile(t, tt.content), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := loadScopeList(filepath.Join(t.TempDir(), "missing.txt"), nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestScopeListResolve(t *testing.T) {
+	lookups := &fakeLookup{addrs: map[string][]string{"inside.test": {"192.0.2.1"}}}
+	scope, err := loadScopeList(writeScopeFile(t, "example.com\n*.example.net\n192.0.2.0/24\n"), lookups.lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope.resolve([]string{"inside.test", "INSIDE.test", "outside.test", "example.com", "api.example.net", "192.0.2.7", ""})
+	if lookups.calls["inside.test"] != 1 || lookups.calls["outside.test"] != 1 || lookups.total() != 2 {
+		t.Errorf("lookups = %v, want one each for inside.test and outside.test", lookups.calls)
+	}
+	if !scope.allows("inside.test") || scope.allows("outside.test") {
+		t.Error("resolved hosts answered wrongly")
+	}
+	scope.resolve([]string{"inside.test", "outside.test"})
+	if lookups.total() != 2 {
+		t.Errorf("lookups = %v, want the resolved hosts answered from the cache", lookups.calls)
+	}
+
+	// Hosts resolve wasn't given are still looked up, once
+	if scope.allows("late.test") || scope.allows("late.test") {
+		t.Error("allows(late.test) = true, want false")
+	}
+	if lookups.calls["late.test"] != 1 {
+		t.Errorf("late.test looked up %d times, want 1", lookups.calls["late.test"])
+	}
+}
+
+// TestScopeListLookupUnlocked checks that a slow lookup doesn't hold up
+// checks of other hosts.
+func TestScopeListLookupUnlocked(t *testing.T) {
+	release := make(chan struct{})
+	scope, err := loadScopeList(writeScopeFile(t, "192.0.2.0/24\n"), func(ctx context.Context, host string) ([]string, error) {
+		if host == "slow.test" {
+			<-release
+		}
+		return []string{"192.0.2.1"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := make(chan bool)
+	go func() { slow <- scope.allows("slow.test") }()
+
+	checked := make(chan bool)
+	go func() {
+		scope.resolve([]string{"fast.test"})
+		checked <- scope.allows("fast.test")
+	}()
+	select {
+	case ok := <-checked:
+		if !ok {
+			t.Error("allows(fast.test) = false, want true")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast.test waited on the lookup of slow.test")
+	}
+	close(release)
+	if !<-slow {
+		t.Error("allows(slow.test) = false, want true")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// shodanSearchURL is the Shodan host search endpoint.
+const shodanSearchURL = "https://api.shodan.io/shodan/host/search"
+
+// shodanMatch is the part of a Shodan search result used to build seed URLs.
+type shodanMatch struct {
+	IP        string          `json:"ip_str"`
+	Port      int             `json:"port"`
+	Hostnames []string        `json:"hostnames"`
+	SSL       json.RawMessage `json:"ssl"`
+}
+
+// shodanTargets searches Shodan for services whose hostnames fall under domain
+// and returns a seed URL for every in-scope hostname and port found. Services
+// Shodan saw speaking TLS get https, the rest http. Only the first page of
+// results is read.
+func shodanTargets(ctx context.Context, client *http.Client, domain, apiKey, userAgent string) ([]string, error) {
+	query := url.Values{"key": {apiKey}, "query": {"hostname:" + domain}}
+	data, err := fetchBody(ctx, client, shodanSearchURL+"?"+query.Encode(), userAgent, 16<<20)
+	if err != nil {
+		// The API key is part of the URL, so keep it out of the error
+		return nil, fmt.Errorf("%s", strings.ReplaceAll(err.Error(), apiKey, "REDACTED"))
+	}
+	var result struct {
+		Matches []shodanMatch `json:"matches"`
+		Error   string        `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("shodan: %s", result.Error)
+	}
+
+	seen := make(map[string]struct{})
+	var targets []string
+	for _, m := range result.Matches {
+		scheme := "http://"
+		if len(m.SSL) > 0 && string(m.SSL) != "null" {
+			scheme = "https://"
+		}
+		for _, host := range m.Hostnames {
+			host = strings.ToLower(host)
+			if !inScope(host, domain) {
+				continue
+			}
+			target := scheme + host + ":" + strconv.Itoa(m.Port) + "/"
+			if _, ok := seen[target]; !ok {
+				seen[target] = struct{}{}
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets, nil
+}
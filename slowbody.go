@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// errSlowBody is returned when a body isn't read in full within -max-body-read-time.
+var errSlowBody = errors.New("body read time exceeded")
+
+// slowBodyReader reads a response body until its read time is used up, then
+// closes the body so that a server dripping bytes can't hold the read open.
+type slowBodyReader struct {
+	body    io.ReadCloser
+	timer   *time.Timer
+	expired int32
+}
+
+// newSlowBodyReader starts the clock on body, which may be read for limit.
+func newSlowBodyReader(body io.ReadCloser, limit time.Duration) *slowBodyReader {
+	r := &slowBodyReader{body: body}
+	r.timer = time.AfterFunc(limit, func() {
+		atomic.StoreInt32(&r.expired, 1)
+		body.Close()
+	})
+	return r
+}
+
+func (r *slowBodyReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if atomic.LoadInt32(&r.expired) == 1 {
+		return n, errSlowBody
+	}
+	return n, err
+}
+
+// stop stops the clock once the body has been read.
+func (r *slowBodyReader) stop() {
+	r.timer.Stop()
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// spoolRunLines is how many lines a sortedSpool buffers before spilling them.
+const spoolRunLines = 100000
+
+// sortedSpool collects output lines as they are found for
+// -output-on-the-fly-sorted. Every runLines lines the buffer is handed to a
+// goroutine that sorts and spills it to a run file, so the lines never have
+// to be held and sorted all at once, and adding never waits on the disk
+// unless two full buffers are already waiting. merge then streams them back
+// as one sorted sequence.
+type sortedSpool struct {
+	dir      string
+	runLines int
+	buf      []string
+	// full carries the buffers to spill to the goroutine writing the runs
+	full chan []string
+	done chan struct{}
+	// finished is set once the last buffer was handed over
+	finished bool
+
+	// runs and err are only written by the spilling goroutine; they can be
+	// read once done is closed
+	runs []string
+	err  error
+}
+
+// newSortedSpool creates a spool with its run files in a new temporary directory.
+func newSortedSpool() (*sortedSpool, error) {
+	return newSortedSpoolRuns(spoolRunLines)
+}
+
+// newSortedSpoolRuns is newSortedSpool with runs of runLines lines.
+func newSortedSpoolRuns(runLines int) (*sortedSpool, error) {
+	dir, err := os.MkdirTemp("", "getends-spool-")
+	if err != nil {
+		return nil, err
+	}
+	s := &sortedSpool{dir: dir, runLines: runLines, full: make(chan []string, 1), done: make(chan struct{})}
+	go s.spillRuns()
+	return s, nil
+}
+
+// add appends a line, handing the buffer over to be spilled once it is full.
+// Errors spilling are returned by merge.
+func (s *sortedSpool) add(line string) {
+	s.buf = append(s.buf, line)
+	if len(s.buf) >= s.runLines {
+		s.full <- s.buf
+		s.buf = make([]string, 0, s.runLines)
+	}
+}
+
+// spillRuns writes each buffer handed over to a run file, until the last.
+// After an error the remaining buffers are dropped.
+func (s *sortedSpool) spillRuns() {
+	defer close(s.done)
+	for lines := range s.full {
+		if s.err == nil {
+			s.err = s.spill(lines)
+		}
+	}
+}
+
+// spill writes lines, sorted, to a new run file.
+func (s *sortedSpool) spill(lines []string) error {
+	sort.Strings(lines)
+	name := filepath.Join(s.dir, fmt.Sprintf("run-%05d", len(s.runs)))
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, line := range lines {
+		w.WriteString(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	s.runs = append(s.runs, name)
+	return nil
+}
+
+// finish hands over the last lines and waits for every run to be written.
+func (s *sortedSpool) finish() error {
+	if !s.finished {
+		s.finished = true
+		if len(s.buf) > 0 {
+			s.full <- s.buf
+			s.buf = nil
+		}
+		close(s.full)
+	}
+	<-s.done
+	return s.err
+}
+
+// merge calls emit with every line added, in sorted order and without
+// duplicates, reading the runs side by side. No lines can be added after it
+// is called; it can be called again to stream the lines a second time.
+func (s *sortedSpool) merge(emit func(string) error) error {
+	if err := s.finish(); err != nil {
+		return err
+	}
+	var h runHeap
+	for _, name := range s.runs {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r := &runReader{reader: bufio.NewReader(file)}
+		if ok, err := r.next(); err != nil {
+			return err
+		} else if ok {
+			h = append(h, r)
+		}
+	}
+	heap.Init(&h)
+	last, emitted := "", false
+	for len(h) > 0 {
+		r := h[0]
+		if !emitted || r.line != last {
+			if err := emit(r.line); err != nil {
+				return err
+			}
+			last, emitted = r.line, true
+		}
+		if ok, err := r.next(); err != nil {
+			return err
+		} else if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return nil
+}
+
+// Close waits for the runs being written and removes the run files.
+func (s *sortedSpool) Close() error {
+	s.finish()
+	return os.RemoveAll(s.dir)
+}
+
+// runReader is a run file being merged, with its current line.
+type runReader struct {
+	reader *bufio.Reader
+	line   string
+}
+
+// next reads the following line of the run, reporting false at its end. Lines
+// are read whole however long they are, as eachFileLine does.
+func (r *runReader) next() (bool, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	if line == "" {
+		return false, nil
+	}
+	r.line = strings.TrimSuffix(line, "\n")
+	return true, nil
+}
+
+// runHeap orders the runs being merged by their current line.
+type runHeap []*runReader
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].line < h[j].line }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// urlSet holds the extracted URLs. With -output-on-the-fly-sorted the URLs
+// are in the spool already, so a hashed set keeps only a 64-bit hash of each
+// to tell whether a URL was found before. Two URLs would have to share a hash
+// for one to be lost, which even millions of URLs make vanishingly unlikely.
+type urlSet struct {
+	urls   map[string]struct{}
+	hashes map[uint64]struct{}
+}
+
+// newURLSet creates a set, keeping only hashes of the URLs if hashed is set.
+func newURLSet(hashed bool) *urlSet {
+	if hashed {
+		return &urlSet{hashes: make(map[uint64]struct{})}
+	}
+	return &urlSet{urls: make(map[string]struct{})}
+}
+
+func hashURL(u string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(u))
+	return h.Sum64()
+}
+
+func (s *urlSet) add(u string) {
+	if s.hashes != nil {
+		s.hashes[hashURL(u)] = struct{}{}
+	} else {
+		s.urls[u] = struct{}{}
+	}
+}
+
+func (s *urlSet) has(u string) bool {
+	var found bool
+	if s.hashes != nil {
+		_, found = s.hashes[hashURL(u)]
+	} else {
+		_, found = s.urls[u]
+	}
+	return found
+}
+
+func (s *urlSet) len() int {
+	if s.hashes != nil {
+		return len(s.hashes)
+	}
+	return len(s.urls)
+}
+
+// sorted returns the URLs in order; a hashed set has none to return.
+func (s *urlSet) sorted() []string {
+	return sortedKeys(s.urls)
+}
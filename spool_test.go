@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSortedSpool(t *testing.T) {
+	s, err := newSortedSpoolRuns(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// 100 distinct lines, each added twice and shuffled across the runs
+	var lines, want []string
+	for i := 0; i < 100; i++ {
+		line := fmt.Sprintf("https://example.com/%03d", i)
+		lines = append(lines, line, line)
+		want = append(want, line)
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(lines), func(i, j int) { lines[i], lines[j] = lines[j], lines[i] })
+	for _, line := range lines {
+		s.add(line)
+	}
+
+	for pass := 0; pass < 2; pass++ {
+		var got []string
+		if err := s.merge(func(line string) error {
+			got = append(got, line)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("pass %d: merged %d lines, want %d sorted and unique", pass, len(got), len(want))
+		}
+	}
+	if len(s.runs) != (len(lines)+6)/7 {
+		t.Errorf("%d runs, want %d", len(s.runs), (len(lines)+6)/7)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.dir); !os.IsNotExist(err) {
+		t.Errorf("run directory left behind: %v", err)
+	}
+}
+
+func TestSortedSpoolEmpty(t *testing.T) {
+	s, err := newSortedSpoolRuns(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.merge(func(line string) error {
+		t.Errorf("emitted %q from an empty spool", line)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSortedSpoolSpillError checks that a run that can't be written is
+// reported by merge rather than lost.
+func TestSortedSpoolSpillError(t *testing.T) {
+	s, err := newSortedSpoolRuns(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	os.RemoveAll(s.dir)
+	for _, line := range []string{"b", "a", "c"} {
+		s.add(line)
+	}
+	if err := s.merge(func(string) error { return nil }); err == nil {
+		t.Error("merge succeeded without a run directory")
+	}
+}
+
+// TestSortedSpoolLongLines checks that lines longer than any read buffer
+// come back whole from the merge.
+func TestSortedSpoolLongLines(t *testing.T) {
+	s, err := newSortedSpoolRuns(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	long := "https://example.com/?q=" + strings.Repeat("a", 3<<20)
+	for _, line := range []string{"https://example.com/b", long, "https://example.com/a", long + "b"} {
+		s.add(line)
+	}
+	var got []string
+	if err := s.merge(func(line string) error {
+		got = append(got, line)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{long, long + "b", "https://example.com/a", "https://example.com/b"}
+	if len(got) != len(want) {
+		t.Fatalf("merged %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d has %d bytes, want %d", i, len(got[i]), len(want[i]))
+		}
+	}
+}
+
+func TestURLSet(t *testing.T) {
+	for _, hashed := range []bool{false, true} {
+		s := newURLSet(hashed)
+		for _, u := range []string{"https://example.com/b", "https://example.com/a", "https://example.com/b"} {
+			s.add(u)
+		}
+		if s.len() != 2 || !s.has("https://example.com/a") || !s.has("https://example.com/b") || s.has("https://example.com/c") {
+			t.Errorf("hashed %v: set of %d URLs has the wrong members", hashed, s.len())
+		}
+		want := "https://example.com/a https://example.com/b"
+		if hashed {
+			want = ""
+		}
+		if got := strings.Join(s.sorted(), " "); got != want {
+			t.Errorf("hashed %v: sorted() = %q, want %q", hashed, got, want)
+		}
+	}
+}
+
+// TestSortedOutput checks that -output-on-the-fly-sorted writes the same
+// lines as sorting in memory, side outputs included.
+func TestSortedOutput(t *testing.T) {
+	var page strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&page, `<a href="/p/%d?id=%d">x</a><a href="/api/v%d/users">y</a>`, (i*37)%50, i, i%3)
+	}
+	srv := serveSite(t, map[string]string{"/": page.String()})
+
+	run := func(extra ...string) ([]string, []string, []string) {
+		dir := t.TempDir()
+		words, params := dir+"/words.txt", dir+"/params.txt"
+		args := append([]string{"-u", srv.URL + "/", "-classify", "-rewrite-output", `s|/api/v\d+/|/api/|`, "-wordlist", words, "-param-wordlist", params}, extra...)
+		return runGetends(t, args...), readLines(t, words), readLines(t, params)
+	}
+	memOut, memWords, memParams := run()
+	spoolOut, spoolWords, spoolParams := run("-output-on-the-fly-sorted")
+	if len(memOut) == 0 || strings.Join(spoolOut, " ") != strings.Join(memOut, " ") {
+		t.Errorf("sorted output = %q, want %q", spoolOut, memOut)
+	}
+	if strings.Join(spoolWords, " ") != strings.Join(memWords, " ") || strings.Join(spoolParams, " ") != strings.Join(memParams, " ") {
+		t.Errorf("side outputs differ: words %q and %q, params %q and %q", spoolWords, memWords, spoolParams, memParams)
+	}
+	// The spool keeps only hashes of the URLs, which still report each one once
+	_, log := runGetendsLog(t, "-u", srv.URL+"/", "-output-on-the-fly-sorted")
+	if n := strings.Count(log, "[EXTRACTED] "+srv.URL+"/api/v1/users"); n != 1 {
+		t.Errorf("/api/v1/users reported %d times, want once", n)
+	}
+	if !containsString(spoolOut, "api") || !containsString(spoolOut, srv.URL+"/api/users") {
+		t.Errorf("output %q lacks the classified, rewritten /api/users", spoolOut)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// stateVersion is bumped whenever the layout of crawlState changes, so that a
+// state file written by a different getends version is rejected, not mis-read.
+const stateVersion = 2
+
+// stateInterval is how often the crawl state is saved while running with -state.
+const stateInterval = 30 * time.Second
+
+// crawlState is the progress of a crawl as persisted with -state.
+type crawlState struct {
+	Version int `json:"version"`
+	// Frontier lists the targets still to be processed, in order, including any
+	// that were in progress when the state was saved
+	Frontier []string `json:"frontier"`
+	// Depths holds the depth of each frontier target that was queued below
+	// the seeds, e.g. a followed iframe, so that depth limits still hold after
+	// a resume; targets not listed are at depth 0
+	Depths map[string]int `json:"depths,omitempty"`
+	// Done lists the targets that have been processed completely
+	Done []string `json:"done"`
+	// Queued is every URL that has been queued, so discovered pages aren't queued twice
+	Queued []string `json:"queued"`
+	// Extracted is every URL extracted so far
+	Extracted []string `json:"extracted"`
+}
+
+// loadState reads a state file written by saveState. A missing file yields a nil state.
+func loadState(filename string) (*crawlState, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the version before decoding the rest, which may have a different layout
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	if header.Version != stateVersion {
+		return nil, fmt.Errorf("state file has version %d, this getends expects version %d", header.Version, stateVersion)
+	}
+
+	var state crawlState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// saveState writes state to filename. It goes through a temporary file, so an
+// interruption never leaves a half-written state.
+func saveState(filename string, state *crawlState) error {
+	state.Version = stateVersion
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, data)
+}
+
+// writeFileAtomic writes data to a temporary file next to filename and renames
+// it into place, so that readers never see a half-written file.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a set in sorted order.
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// traceTransport wraps a RoundTripper for -trace, writing each request and
+// response header block to stderr along with DNS, connection and TLS events.
+// Every request, including redirects and PDF/CSS fetches, gets its own number
+// so that lines from concurrent requests can be told apart.
+type traceTransport struct {
+	next http.RoundTripper
+	seq  int64
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := atomic.AddInt64(&t.seq, 1)
+	start := time.Now()
+	logf := func(format string, args ...interface{}) {
+		fmt.Fprintln(os.Stderr, color.WhiteString("[TRACE #%d +%s]", id, time.Since(start).Round(time.Millisecond)), fmt.Sprintf(format, args...))
+	}
+	dump := func(data []byte) {
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\r\n"), "\n") {
+			fmt.Fprintln(os.Stderr, color.WhiteString("[TRACE #%d]", id), strings.TrimRight(line, "\r"))
+		}
+	}
+
+	trace := &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			logf("Getting connection to %s", hostPort)
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			logf("DNS lookup of %s", info.Host)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err != nil {
+				logf("DNS lookup failed: %v", info.Err)
+				return
+			}
+			addrs := make([]string, len(info.Addrs))
+			for i, addr := range info.Addrs {
+				addrs[i] = addr.String()
+			}
+			logf("DNS resolved to %s", strings.Join(addrs, ", "))
+		},
+		ConnectStart: func(network, addr string) {
+			logf("Connecting to %s (%s)", addr, network)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				logf("Connecting to %s failed: %v", addr, err)
+			} else {
+				logf("Connected to %s", addr)
+			}
+		},
+		TLSHandshakeStart: func() {
+			logf("TLS handshake started")
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				logf("TLS handshake failed: %v", err)
+				return
+			}
+			logf("TLS handshake done: %s, %s, ALPN %q", tlsVersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), state.NegotiatedProtocol)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				logf("Reusing connection to %s (idle %s)", info.Conn.RemoteAddr(), info.IdleTime)
+			} else {
+				logf("Got connection to %s", info.Conn.RemoteAddr())
+			}
+		},
+		GotFirstResponseByte: func() {
+			logf("First response byte received")
+		},
+	}
+	// DumpRequestOut sends the request through a fake connection, so it has to
+	// happen before the trace is attached
+	if data, err := httputil.DumpRequestOut(req, false); err == nil {
+		dump(data)
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		logf("Request failed: %v", err)
+		return nil, err
+	}
+	if data, err := httputil.DumpResponse(resp, false); err == nil {
+		dump(data)
+	}
+	return resp, nil
+}
+
+// tlsVersionName returns the name of a TLS version, e.g. "TLS 1.3".
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("TLS 0x%04x", version)
+}
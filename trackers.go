@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"os"
+	"strings"
+)
+
+// defaultTrackers is the built-in tracker domain list.
+//
+//go:embed trackers.txt
+var defaultTrackers string
+
+// trackerSet holds tracker domains; each one also matches its subdomains.
+type trackerSet map[string]struct{}
+
+// parseTrackers reads one domain per line, ignoring blank lines and # comments.
+func parseTrackers(r io.Reader) (trackerSet, error) {
+	trackers := make(trackerSet)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		trackers[strings.TrimPrefix(strings.TrimSuffix(line, "."), "*.")] = struct{}{}
+	}
+	return trackers, scanner.Err()
+}
+
+// loadTrackers returns the tracker list from filename, or the built-in list when filename is empty.
+func loadTrackers(filename string) (trackerSet, error) {
+	if filename == "" {
+		return parseTrackers(strings.NewReader(defaultTrackers))
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseTrackers(file)
+}
+
+// matches reports whether hostname is a tracker domain or one of its
+// subdomains, so "www.google-analytics.com" matches "google-analytics.com"
+// but "notgoogle-analytics.com" doesn't. A nil set matches nothing.
+func (t trackerSet) matches(hostname string) bool {
+	if len(t) == 0 {
+		return false
+	}
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	for {
+		if _, ok := t[hostname]; ok {
+			return true
+		}
+		dot := strings.IndexByte(hostname, '.')
+		if dot < 0 {
+			return false
+		}
+		hostname = hostname[dot+1:]
+	}
+}
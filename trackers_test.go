@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrackerSetMatches(t *testing.T) {
+	trackers, err := parseTrackers(strings.NewReader(`
+# comment
+google-analytics.com
+*.hotjar.com
+Segment.IO.
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"google-analytics.com", true},
+		{"www.google-analytics.com", true},
+		{"ssl.WWW.Google-Analytics.com", true},
+		{"google-analytics.com.", true},
+		{"notgoogle-analytics.com", false},
+		{"google-analytics.com.example.com", false},
+		{"hotjar.com", true},
+		{"static.hotjar.com", true},
+		{"cdn.segment.io", true},
+		{"segment.com", false},
+		{"example.com", false},
+		{"com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := trackers.matches(tt.host); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestNilTrackerSet(t *testing.T) {
+	var trackers trackerSet
+	if trackers.matches("google-analytics.com") {
+		t.Error("a nil set matched")
+	}
+}
+
+func TestDefaultTrackers(t *testing.T) {
+	trackers, err := loadTrackers("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"www.google-analytics.com", "www.googletagmanager.com", "connect.facebook.net", "static.hotjar.com"} {
+		if !trackers.matches(host) {
+			t.Errorf("built-in list doesn't match %q", host)
+		}
+	}
+	// Only connect.facebook.net is listed, not the whole of facebook.net
+	if trackers.matches("facebook.net") {
+		t.Error("built-in list matches facebook.net")
+	}
+}
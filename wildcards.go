@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSubdomains is the built-in wordlist for -expand-wildcards.
+//
+//go:embed subdomains.txt
+var defaultSubdomains string
+
+// wildcardLookupTimeout bounds each DNS query made while expanding a wildcard.
+const wildcardLookupTimeout = 5 * time.Second
+
+// wildcardLookups is how many brute-force lookups run at once.
+const wildcardLookups = 20
+
+// parseWildcardTarget splits a target such as "*.example.com" or
+// "https://*.example.com" into its scheme ("" when absent) and domain.
+func parseWildcardTarget(target string) (scheme, domain string, ok bool) {
+	target = strings.TrimSpace(target)
+	if i := strings.Index(target, "://"); i >= 0 {
+		scheme, target = target[:i+3], target[i+3:]
+	}
+	if !strings.HasPrefix(target, "*.") {
+		return "", "", false
+	}
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimPrefix(target, "*.")), "/")
+	if domain == "" || strings.ContainsAny(domain, "*/?#:") {
+		return "", "", false
+	}
+	return scheme, domain, true
+}
+
+// loadSubdomainWords returns the wordlist from filename, or the built-in list
+// when filename is empty. Blank lines and # comments are skipped.
+func loadSubdomainWords(filename string) ([]string, error) {
+	var r io.Reader = strings.NewReader(defaultSubdomains)
+	if filename != "" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word != "" && !strings.HasPrefix(word, "#") {
+			words = append(words, word)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// expandWildcard finds hosts under domain: its NS and MX hosts that fall
+// inside the domain, and every word.domain that resolves. The brute force is
+// skipped when the domain has wildcard DNS, as every name would resolve.
+// Hosts are returned in the order they were confirmed, NS and MX first.
+func expandWildcard(resolver *net.Resolver, domain string, words []string) ([]string, error) {
+	lookup := func(fn func(ctx context.Context) error) error {
+		ctx, cancel := context.WithTimeout(context.Background(), wildcardLookupTimeout)
+		defer cancel()
+		return fn(ctx)
+	}
+
+	seen := make(map[string]struct{})
+	var hosts []string
+	add := func(host string) {
+		host = strings.TrimSuffix(strings.ToLower(host), ".")
+		if !inScope(host, domain) || host == domain {
+			return
+		}
+		if _, ok := seen[host]; !ok {
+			seen[host] = struct{}{}
+			hosts = append(hosts, host)
+		}
+	}
+
+	lookup(func(ctx context.Context) error {
+		nss, err := resolver.LookupNS(ctx, domain)
+		for _, ns := range nss {
+			add(ns.Host)
+		}
+		return err
+	})
+	lookup(func(ctx context.Context) error {
+		mxs, err := resolver.LookupMX(ctx, domain)
+		for _, mx := range mxs {
+			add(mx.Host)
+		}
+		return err
+	})
+
+	probe := fmt.Sprintf("getends-%d.%s", time.Now().UnixNano(), domain)
+	if lookup(func(ctx context.Context) error {
+		_, err := resolver.LookupHost(ctx, probe)
+		return err
+	}) == nil {
+		return hosts, fmt.Errorf("%s has wildcard DNS, skipping the subdomain brute force", domain)
+	}
+
+	resolved := make([]bool, len(words))
+	slots := make(chan struct{}, wildcardLookups)
+	var wg sync.WaitGroup
+	for i, word := range words {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, host string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			resolved[i] = lookup(func(ctx context.Context) error {
+				_, err := resolver.LookupHost(ctx, host)
+				return err
+			}) == nil
+		}(i, word+"."+domain)
+	}
+	wg.Wait()
+
+	for i, word := range words {
+		if resolved[i] {
+			add(word + "." + domain)
+		}
+	}
+	return hosts, nil
+}
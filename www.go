@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// wwwVariant returns target with www. added to its host when the host is a
+// naked domain, or removed when the host is www. in front of one. Other
+// subdomains and IP addresses have no variant. Targets without a scheme keep
+// having none, and the port, path and query are kept as they are.
+func wwwVariant(target string) (string, bool) {
+	schemeless := !strings.Contains(target, "://")
+	if schemeless {
+		target = "http://" + target
+	}
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return "", false
+	}
+	host := hostKey(parsed.Hostname())
+
+	var variant string
+	switch {
+	case apexDomain(host) == "":
+		return "", false
+	case apexDomain(host) == host:
+		variant = "www." + host
+	case strings.HasPrefix(host, "www.") && apexDomain(host) == host[len("www."):]:
+		variant = host[len("www."):]
+	default:
+		return "", false
+	}
+	if port := parsed.Port(); port != "" {
+		variant += ":" + port
+	}
+	parsed.Host = variant
+
+	result := parsed.String()
+	if schemeless {
+		result = strings.TrimPrefix(result, "http://")
+	}
+	return result, true
+}